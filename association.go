@@ -0,0 +1,528 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 删除主表数据时子表的处理方式 | 一对多字段标记 onDelete:"cascade"
+const (
+	OnDeleteCascade  = "cascade"  // 级联删除子表数据
+	OnDeleteRestrict = "restrict" // 存在子表数据时不允许删除
+	OnDeleteDetach   = "detach"   // 解除关联,清空子表外键
+)
+
+// 预加载一对多子表 | 删除主表数据前加载,用于处理子表数据和记录日志
+func (b *BaseModel[T]) preloadHasMany(db *gorm.DB) (*gorm.DB, error) {
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range modelSchema.Relationships.HasMany {
+		db = db.Preload(rel.Name, func(db *gorm.DB) *gorm.DB {
+			return db.Order("id asc")
+		})
+	}
+	return db, nil
+}
+
+// 按一对多字段的onDelete标记处理子表数据 | list需要预加载一对多子表,未标记的字段不处理
+//
+// 级联软删除的子表数据与主表使用同一个删除时间deletedAt,恢复主表时据此恢复子表
+func (b *BaseModel[T]) deleteAssociations(tx *gorm.DB, list []*T, deletedAt time.Time) error {
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return err
+	}
+	for _, rel := range modelSchema.Relationships.HasMany {
+		action := rel.Field.Tag.Get("onDelete")
+		if action == "" {
+			continue
+		}
+
+		// 收集子表数据
+		children := make([]reflect.Value, 0)
+		for _, item := range list {
+			value := rel.Field.ReflectValueOf(tx.Statement.Context, reflect.ValueOf(item).Elem())
+			for i := 0; i < value.Len(); i++ {
+				if child := value.Index(i); indirectValue(child).IsValid() {
+					children = append(children, child)
+				}
+			}
+		}
+		if len(children) == 0 {
+			continue
+		}
+		childIds := make([]uint64, 0, len(children))
+		for _, child := range children {
+			childIds = append(childIds, entityIdOf(indirectValue(child)))
+		}
+		childModel := reflect.New(rel.FieldSchema.ModelType).Interface()
+
+		switch action {
+		case OnDeleteRestrict:
+			return fmt.Errorf("[%s]存在关联的[%s]数据,不允许删除", b.TableName, rel.FieldSchema.Table)
+		case OnDeleteCascade:
+			if err := b.cascadeDelete(tx, rel.FieldSchema, childModel, childIds, deletedAt); err != nil {
+				return err
+			}
+			for _, child := range children {
+				if err := b.RecordLog(LogTypeDelete, "级联删除", childData(child), nil); err != nil {
+					return err
+				}
+			}
+		case OnDeleteDetach:
+			if err := b.detachChildren(tx, rel, childModel, childIds, children); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("[%s]字段[%s]的onDelete[%s]不支持,请开发检查", b.TableName, rel.Name, action)
+		}
+	}
+	return nil
+}
+
+// 级联删除子表数据 | 子表有删除标记时软删除,否则物理删除
+func (b *BaseModel[T]) cascadeDelete(tx *gorm.DB, childSchema *schema.Schema, childModel any, ids []uint64, deletedAt time.Time) error {
+	if childSchema.LookUpField("deleted_at") == nil {
+		return tx.Where("id in ?", ids).Delete(childModel).Error
+	}
+	updates := map[string]any{"deleted_at": deletedAt}
+	if childSchema.LookUpField("deleted_by") != nil {
+		updates["deleted_by"] = b.OperatorId
+	}
+	return tx.Model(childModel).Where("id in ?", ids).UpdateColumns(updates).Error
+}
+
+// 恢复级联删除的子表数据 | list为已删除的主表数据,只恢复删除时间与主表相同的子表数据,每条记录一条操作日志
+func (b *BaseModel[T]) restoreAssociations(tx *gorm.DB, list []*T) error {
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return err
+	}
+	deletedField := modelSchema.LookUpField("deleted_at")
+	if deletedField == nil {
+		return nil
+	}
+	ctx := tx.Statement.Context
+	for _, rel := range modelSchema.Relationships.HasMany {
+		if rel.Field.Tag.Get("onDelete") != OnDeleteCascade || rel.FieldSchema.LookUpField("deleted_at") == nil {
+			continue
+		}
+		childModel := reflect.New(rel.FieldSchema.ModelType).Interface()
+		for _, item := range list {
+			parentValue := reflect.ValueOf(item).Elem()
+			value, _ := deletedField.ValueOf(ctx, parentValue)
+			deletedAt, ok := value.(gorm.DeletedAt)
+			if !ok || !deletedAt.Valid {
+				continue
+			}
+
+			// 1. 查询同一时间级联删除的子表数据
+			children := reflect.New(reflect.SliceOf(reflect.PointerTo(rel.FieldSchema.ModelType)))
+			err := tx.Unscoped().Model(childModel).
+				Where(childConds(ctx, rel, parentValue)).
+				Where("`deleted_at` = ?", deletedAt.Time).
+				Order("id asc").
+				Find(children.Interface()).Error
+			if err != nil {
+				return err
+			}
+			if children.Elem().Len() == 0 {
+				continue
+			}
+
+			// 2. 恢复数据
+			childIds := make([]uint64, 0, children.Elem().Len())
+			for i := 0; i < children.Elem().Len(); i++ {
+				childIds = append(childIds, entityIdOf(indirectValue(children.Elem().Index(i))))
+			}
+			updates := map[string]any{"deleted_at": nil}
+			if rel.FieldSchema.LookUpField("deleted_by") != nil {
+				updates["deleted_by"] = ""
+			}
+			if err := tx.Unscoped().Model(childModel).Where("id in ?", childIds).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+
+			// 3. 记录日志
+			for i := 0; i < children.Elem().Len(); i++ {
+				if err := b.RecordLog(LogTypeRestore, "级联恢复", nil, childData(children.Elem().Index(i))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 彻底删除子表数据 | 物理删除一对多子表中删除时间早于cutoff的数据,每条记录一条操作日志
+func (b *BaseModel[T]) purgeAssociations(tx *gorm.DB, cutoff time.Time) error {
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return err
+	}
+	for _, rel := range modelSchema.Relationships.HasMany {
+		if rel.FieldSchema.LookUpField("deleted_at") == nil {
+			continue
+		}
+		childModel := reflect.New(rel.FieldSchema.ModelType).Interface()
+		ids := make([]uint64, 0)
+		err := tx.Unscoped().Model(childModel).Where("`deleted_at` < ?", cutoff).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if err := tx.Unscoped().Where("id in ?", ids).Delete(childModel).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			child := reflect.New(rel.FieldSchema.ModelType)
+			_ = rel.FieldSchema.PrioritizedPrimaryField.Set(tx.Statement.Context, child.Elem(), id)
+			if err := b.RecordLog(LogTypePurge, "彻底删除", child.Interface(), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 子表外键条件 | 按关联关系取主表数据的值
+func childConds(ctx context.Context, rel *schema.Relationship, parentValue reflect.Value) map[string]any {
+	conds := make(map[string]any)
+	for _, ref := range rel.References {
+		if ref.OwnPrimaryKey {
+			conds[ref.ForeignKey.DBName], _ = ref.PrimaryKey.ValueOf(ctx, parentValue)
+		} else if ref.PrimaryValue != "" {
+			conds[ref.ForeignKey.DBName] = ref.PrimaryValue
+		}
+	}
+	return conds
+}
+
+// 解除关联 | 清空子表外键,每条子表数据记录一条操作日志
+func (b *BaseModel[T]) detachChildren(tx *gorm.DB, rel *schema.Relationship, childModel any, ids []uint64, children []reflect.Value) error {
+	updates := make(map[string]any)
+	for _, ref := range rel.References {
+		if ref.OwnPrimaryKey {
+			updates[ref.ForeignKey.DBName] = reflect.Zero(ref.ForeignKey.FieldType).Interface()
+		}
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	err := tx.Model(childModel).Where("id in ?", ids).UpdateColumns(updates).Error
+	if err != nil {
+		return err
+	}
+
+	// 记录日志
+	for _, child := range children {
+		newChild := reflect.New(child.Type()).Elem()
+		cloneValue(newChild, child)
+		for _, ref := range rel.References {
+			if ref.OwnPrimaryKey {
+				_ = ref.ForeignKey.Set(tx.Statement.Context, indirectValue(newChild), updates[ref.ForeignKey.DBName])
+			}
+		}
+		if err := b.RecordLog(LogTypeUpdate, "解除关联", childData(child), childData(newChild)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 子表数据 | 转换为指针,保证能读取到TableName
+func childData(child reflect.Value) any {
+	if child.Kind() != reflect.Ptr && child.CanAddr() {
+		return child.Addr().Interface()
+	}
+	return child.Interface()
+}
+
+// 同步一对多子表数据 | 对比数据库中的子表数据,新增、更新、删除,并回填外键
+//
+// 子表字段为nil时不处理,为空切片时删除全部子表数据;每条子表数据变更记录一条操作日志;
+// oldData为更新前的数据,关联字段被修改时按旧值查询子表数据,没有时为nil;指定names时只同步这些字段
+func (b *BaseModel[T]) syncAssociations(tx *gorm.DB, data, oldData *T, names ...string) error {
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return err
+	}
+	ctx := tx.Statement.Context
+	parentValue := reflect.ValueOf(data).Elem()
+	for _, rel := range modelSchema.Relationships.HasMany {
+		if len(names) > 0 && !slices.Contains(names, rel.Name) {
+			continue
+		}
+		children := rel.Field.ReflectValueOf(ctx, parentValue)
+		if children.IsNil() {
+			continue
+		}
+
+		// 1. 回填外键
+		if err := fillForeignKeys(ctx, rel, parentValue, children); err != nil {
+			return err
+		}
+
+		// 2. 查询数据库中的子表数据 | 关联字段被修改时按旧值查询
+		conds := childConds(ctx, rel, parentValue)
+		if oldData != nil {
+			conds = childConds(ctx, rel, reflect.ValueOf(oldData).Elem())
+		}
+		childModel := reflect.New(rel.FieldSchema.ModelType).Interface()
+		existing := reflect.New(reflect.SliceOf(reflect.PointerTo(rel.FieldSchema.ModelType)))
+		if err := tx.Model(childModel).Where(conds).Order("id asc").Find(existing.Interface()).Error; err != nil {
+			return err
+		}
+		existMap := make(map[uint64]reflect.Value, existing.Elem().Len())
+		for i := 0; i < existing.Elem().Len(); i++ {
+			existMap[entityIdOf(indirectValue(existing.Elem().Index(i)))] = existing.Elem().Index(i)
+		}
+
+		// 3. 新增或更新
+		kept := make(map[uint64]struct{}, children.Len())
+		for i := 0; i < children.Len(); i++ {
+			child := children.Index(i)
+			if !indirectValue(child).IsValid() {
+				continue
+			}
+			id := entityIdOf(indirectValue(child))
+			if id == 0 {
+				if err := tx.Omit(OmitUpdateFileds...).Create(childData(child)).Error; err != nil {
+					return err
+				}
+				if err := b.RecordLog(LogTypeCreate, "新增", nil, childData(child)); err != nil {
+					return err
+				}
+				continue
+			}
+			old, exist := existMap[id]
+			if !exist {
+				return fmt.Errorf("[%s]子表[%s]数据[%d]不属于当前数据,请检查", b.TableName, rel.FieldSchema.Table, id)
+			}
+			kept[id] = struct{}{}
+			columns := changedColumns(ctx, rel.FieldSchema, indirectValue(old), indirectValue(child))
+			if len(columns) == 0 {
+				continue
+			}
+			if err := updateColumns(tx, rel.FieldSchema, childData(child), columns).Error; err != nil {
+				return err
+			}
+			if err := b.RecordLog(LogTypeUpdate, "更新", childData(old), childData(child)); err != nil {
+				return err
+			}
+		}
+
+		// 4. 删除移除的子表数据
+		removedIds := make([]uint64, 0)
+		for i := 0; i < existing.Elem().Len(); i++ {
+			old := existing.Elem().Index(i)
+			id := entityIdOf(indirectValue(old))
+			if _, ok := kept[id]; ok {
+				continue
+			}
+			removedIds = append(removedIds, id)
+			if err := b.RecordLog(LogTypeDelete, "删除", childData(old), nil); err != nil {
+				return err
+			}
+		}
+		if len(removedIds) > 0 {
+			if err := b.cascadeDelete(tx, rel.FieldSchema, childModel, removedIds, time.Now()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 新增一对多子表数据 | 回填外键后逐条新增,每条记录一条操作日志
+//
+// 主表数据刚落库,不查询数据库中的子表数据,避免把已删除的同业务编码数据遗留的子表数据当作自己的
+func (b *BaseModel[T]) createAssociations(tx *gorm.DB, data *T) error {
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return err
+	}
+	ctx := tx.Statement.Context
+	parentValue := reflect.ValueOf(data).Elem()
+	for _, rel := range modelSchema.Relationships.HasMany {
+		children := rel.Field.ReflectValueOf(ctx, parentValue)
+		if children.IsNil() {
+			continue
+		}
+		if err := fillForeignKeys(ctx, rel, parentValue, children); err != nil {
+			return err
+		}
+		for i := 0; i < children.Len(); i++ {
+			child := children.Index(i)
+			if !indirectValue(child).IsValid() {
+				continue
+			}
+			if id := entityIdOf(indirectValue(child)); id != 0 {
+				return fmt.Errorf("[%s]子表[%s]数据[%d]不属于当前数据,请检查", b.TableName, rel.FieldSchema.Table, id)
+			}
+			if err := tx.Omit(OmitUpdateFileds...).Create(childData(child)).Error; err != nil {
+				return err
+			}
+			if err := b.RecordLog(LogTypeCreate, "新增", nil, childData(child)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 回填子表外键 | 按关联关系取主表数据的值
+func fillForeignKeys(ctx context.Context, rel *schema.Relationship, parentValue, children reflect.Value) error {
+	for column, value := range childConds(ctx, rel, parentValue) {
+		field := rel.FieldSchema.LookUpField(column)
+		for i := 0; i < children.Len(); i++ {
+			if child := indirectValue(children.Index(i)); child.IsValid() {
+				if err := field.Set(ctx, child, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 一对多字段名 | 保存主表时排除,由syncAssociations处理
+func (b *BaseModel[T]) hasManyFields() ([]string, error) {
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(modelSchema.Relationships.HasMany))
+	for _, rel := range modelSchema.Relationships.HasMany {
+		names = append(names, rel.Name)
+	}
+	return names, nil
+}
+
+// 对比有变化的字段 | 只对比可更新的表字段,不含主键、版本号和创建、更新信息
+func changedColumns(ctx context.Context, modelSchema *schema.Schema, oldValue, newValue reflect.Value) []string {
+	columns := make([]string, 0)
+	for _, field := range modelSchema.Fields {
+		if field.DBName == "" || !field.Updatable || field.PrimaryKey || field.Tag.Get("lock") == "version" {
+			continue
+		}
+		if slices.Contains(OmitCreateFileds, field.DBName) || slices.Contains(OmitUpdateFileds, field.DBName) {
+			continue
+		}
+		oldVal, _ := field.ValueOf(ctx, oldValue)
+		newVal, _ := field.ValueOf(ctx, newValue)
+		if !reflect.DeepEqual(oldVal, newVal) {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns
+}
+
+// 按字段更新 | 同时更新更新人信息
+func updateColumns(tx *gorm.DB, modelSchema *schema.Schema, data any, columns []string) *gorm.DB {
+	selects := slices.Clone(columns)
+	for _, column := range OmitUpdateFileds {
+		if modelSchema.LookUpField(column) != nil {
+			selects = append(selects, column)
+		}
+	}
+	return tx.Model(data).Select(selects).Updates(data)
+}
+
+// 新增聚合数据 | 先新增主表(多条时批量插入),再逐条新增一对多子表数据并回填外键
+func (b *BaseModel[T]) createAggregate(tx *gorm.DB, list ...*T) error {
+	fields, err := b.hasManyFields()
+	if err != nil {
+		return err
+	}
+	err = tx.Omit(append(slices.Clone(OmitUpdateFileds), fields...)...).Create(list).Error
+	if err != nil {
+		return err
+	}
+	for _, data := range list {
+		if err := b.createAssociations(tx, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 一对多以外的关联 | 返回一对一、属于、多对多关联的字段名,以及属于关联在主表上的外键字段
+func (b *BaseModel[T]) otherAssociations() ([]string, error) {
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, rel := range modelSchema.Relationships.HasOne {
+		names = append(names, rel.Name)
+	}
+	for _, rel := range modelSchema.Relationships.BelongsTo {
+		names = append(names, rel.Name)
+		for _, ref := range rel.References {
+			if !ref.OwnPrimaryKey && ref.ForeignKey != nil && ref.ForeignKey.DBName != "" {
+				names = append(names, ref.ForeignKey.DBName)
+			}
+		}
+	}
+	for _, rel := range modelSchema.Relationships.Many2Many {
+		names = append(names, rel.Name)
+	}
+	return names, nil
+}
+
+// 更新聚合数据 | 先更新主表有变化的字段并完整保存一对多以外的关联,再同步一对多子表数据
+//
+// 有旧数据时先与旧数据对比校验字段编辑权限;没有旧数据时保存全部字段,其他关联同样完整保存
+func (b *BaseModel[T]) updateAggregate(tx *gorm.DB, data, oldData *T) error {
+	if oldData != nil {
+		if err := b.checkEditable(oldData, data); err != nil {
+			return err
+		}
+		modelSchema, err := b.parseSchema()
+		if err != nil {
+			return err
+		}
+		columns := changedColumns(tx.Statement.Context, modelSchema, reflect.ValueOf(oldData).Elem(), reflect.ValueOf(data).Elem())
+		names, err := b.otherAssociations()
+		if err != nil {
+			return err
+		}
+		db := tx
+		if len(names) > 0 {
+			db = tx.Session(&gorm.Session{FullSaveAssociations: true, Context: tx.Statement.Context})
+			for _, name := range names {
+				if !slices.Contains(columns, name) {
+					columns = append(columns, name)
+				}
+			}
+		}
+		if err := b.updateWithVersion(db, data, columns); err != nil {
+			return err
+		}
+		return b.syncAssociations(tx, data, oldData)
+	}
+
+	fields, err := b.hasManyFields()
+	if err != nil {
+		return err
+	}
+	session := &gorm.Session{FullSaveAssociations: true, Context: tx.Statement.Context}
+	omits := append(slices.Clone(OmitCreateFileds), fields...)
+	err = b.saveWithVersion(tx.Omit(omits...).Session(session).Clauses(clause.OnConflict{UpdateAll: true}), data)
+	if err != nil {
+		return err
+	}
+	return b.syncAssociations(tx, data, oldData)
+}
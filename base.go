@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
 	"strings"
 	"sync"
@@ -14,12 +15,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jianyuezhexue/base/db"
-	"github.com/jianyuezhexue/base/localCache"
 	"github.com/jianyuezhexue/base/tool"
 	"github.com/jinzhu/copier"
 	"github.com/looplab/fsm"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 var OmitCreateFileds = []string{"created_at", "create_by", "create_by_name"}
@@ -28,7 +29,7 @@ var OmitUpdateFileds = []string{"updated_at", "update_by", "update_by_name"}
 // 底层类型约定
 type SearchCondition = func(db *gorm.DB) *gorm.DB
 type PreloadsType = map[string][]any
-type RecordLogFunc = func(ctx *gin.Context, operatorType, operatorTypeName string, oldData, newData any) error
+type RecordLogFunc = func(ctx ModelContext, operatorType, operatorTypeName string, oldData, newData any) error
 
 var safeColumnNameRegex = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)(\.[a-zA-Z_][a-zA-Z0-9_]*)*$`)
 
@@ -49,21 +50,37 @@ type BaseModelInterface[T any] interface {
 	TableName() string                                                                                                               // 表名
 	Tx() *gorm.DB                                                                                                                    // 获取事务DB
 	Transaction(fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error                                                            // 事务处理
+	TransactionWithPropagation(propagation Propagation, fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error                    // 按传播方式处理事务
+	OnCommit(fn func())                                                                                                              // 注册事务提交后回调
+	OnRollback(fn func())                                                                                                            // 注册事务回滚后回调
 	SetData(data any) (*T, error)                                                                                                    // 设置数据
 	Validate() error                                                                                                                 // 数据校验
+	ValidateDelete() error                                                                                                           // 删除校验
 	Complete() error                                                                                                                 // 完善数据
 	Create() (*T, error)                                                                                                             // 新增数据
 	CreateWithData(*T) (*T, error)                                                                                                   // 保存数据
+	CreateBatch(items []*T, chunkSize int) (*BatchResult, error)                                                                     // 批量新增
+	UpsertByBusinessCode(fieldName string, data *T) (bool, error)                                                                    // 按业务编码新增或更新
+	UpsertByBusinessCodes(fieldName string, items []*T) ([]bool, error)                                                              // 按业务编码批量新增或更新
 	Update() (*T, error)                                                                                                             // 更新数据
 	UpdateWithData(data *T) (*T, error)                                                                                              // 使用传入对象更新数据
+	UpdateFields(fields ...string) (*T, error)                                                                                       // 更新指定字段
+	ChangedFields() []string                                                                                                         // 对比快照有变化的字段
+	MaskFields(data any) error                                                                                                       // 字段脱敏 | 输出前调用
 	LoadData(cond SearchCondition, preloads ...PreloadsType) (*T, error)                                                             // 加载数据
 	LoadById(id uint64, preloads ...PreloadsType) (*T, error)                                                                        // 根据Id加载数据
+	LoadDataForUpdate(cond SearchCondition, preloads ...PreloadsType) (*T, error)                                                    // 加锁加载数据 | 事务中使用
+	LoadDataWithLock(cond SearchCondition, mode LockMode, preloads ...PreloadsType) (*T, error)                                      // 指定锁模式加载数据 | 事务中使用
+	LoadByIdForUpdate(id uint64, preloads ...PreloadsType) (*T, error)                                                               // 根据Id加锁加载数据 | 事务中使用
+	LoadByIdWithLock(id uint64, mode LockMode, preloads ...PreloadsType) (*T, error)                                                 // 根据Id指定锁模式加载数据 | 事务中使用
 	LoadByBusinessCode(filedName, filedValue string, preloads ...PreloadsType) (*T, error)                                           // 根据业务编码查询数据
 	GetById(Id uint64, preloads ...PreloadsType) (*T, error)                                                                         // 根据Id查询数据
 	GetByIds(Ids []uint64, preloads ...PreloadsType) ([]*T, error)                                                                   // 根据Id查询数据
 	Repair() error                                                                                                                   // 修复数据
 	Count(conds ...SearchCondition) (int64, error)                                                                                   // 统计数据条数
 	List(conds ...SearchCondition) ([]*T, error)                                                                                     // 查询列表数据
+	ListPage(search any) (*PageResult[T], error)                                                                                     // 分页查询
+	Each(batchSize int, fn func(batch []*T) error, conds ...SearchCondition) error                                                   // 分批遍历数据
 	ListByIds(Ids []uint64, preloads ...PreloadsType) ([]*T, error)                                                                  // 根据Ids查询数据
 	ListByBusinessCode(filedName, filedValue string, preloads ...PreloadsType) ([]*T, error)                                         // 根据业务编码查询列表数据
 	CountByBusinessCode(filedName, filedValue string) (int64, error)                                                                 // 根据业务编码统计数量
@@ -71,6 +88,11 @@ type BaseModelInterface[T any] interface {
 	CountByBusinessCodes(filedName string, filedValues []string) (int64, error)                                                      // 根据业务编码列表统计数量
 	MaxId() (int64, error)                                                                                                           // 获取最大ID
 	Del(ids ...uint64) error                                                                                                         // 删除数据
+	UpdateWhere(cond SearchCondition, changes map[string]any) (int64, error)                                                         // 按条件批量更新
+	DeleteWhere(cond SearchCondition) (int64, error)                                                                                 // 按条件批量删除
+	Restore(ids ...uint64) error                                                                                                     // 恢复已删除的数据
+	ListTrashed(conds ...SearchCondition) ([]*T, error)                                                                              // 查询已删除的数据
+	Purge(olderThan time.Duration) (int64, error)                                                                                    // 彻底删除超过保留期的数据
 	CheckBusinessCodeExist(filedName, businessCode string) (bool, error)                                                             // 检查业务编码是否重复
 	BusinessCodeCannotRepeat(filedName, businessCode string) error                                                                   // 业务编码不能重复
 	CheckBusinessCodesExist(filedName string, values []string) (map[int]bool, error)                                                 // 批量检查业务编码是否存在
@@ -80,6 +102,9 @@ type BaseModelInterface[T any] interface {
 	ReInit(entity *T, baseModel *BaseModel[T]) error                                                                                 // 重置模型中的Context和Db
 	InitStateMachine(initStatus string, events []fsm.EventDesc, afterEvent fsm.Callback, callbacks ...map[string]fsm.Callback) error // 初始化状态机
 	EventExecution(initStatus, event, eventZhName string, args ...any) error                                                         // 执行事件
+	History(id uint64) ([]*HistoryItem, error)                                                                                       // 查询操作记录
+	RaiseEvent(topic string, payload any)                                                                                            // 记录领域事件
+	FlushEvents(data *T) error                                                                                                       // 写入领域事件到outbox表
 }
 
 // 公共模型属性
@@ -93,7 +118,7 @@ type BaseModel[T any] struct {
 	UpdatedAt             db.LocalTime      `json:"updatedAt" gorm:"<-:update" search:"-"`    // 更新时间
 	DeletedAt             gorm.DeletedAt    `json:"-" gorm:"index" search:"-"`                // 删除标记
 	Db                    *gorm.DB          `json:"-" gorm:"-" search:"-"`                    // 数据库连接
-	Ctx                   *gin.Context      `json:"-" gorm:"-" search:"-"`                    // 上下文
+	Ctx                   ModelContext      `json:"-" gorm:"-" search:"-"`                    // 上下文
 	Preloads              map[string][]any  `json:"-" gorm:"-" search:"-"`                    // 预加载
 	TableName             string            `json:"-" gorm:"-" search:"-"`                    // 表名
 	OperatorId            string            `json:"-" gorm:"-" search:"-"`                    // 操作日志操作人id
@@ -102,19 +127,50 @@ type BaseModel[T any] struct {
 	DefaultSearchConditon SearchCondition   `json:"-" gorm:"-" search:"-" copier:"-" vd:"-"`  // 默认搜索条件
 	PermissionConditons   []SearchCondition `json:"-" gorm:"-" search:"-" copier:"-" vd:"-"`  // 权限条件
 	StatesMachine         *fsm.FSM          `json:"-" gorm:"-" search:"-" copier:"-" vd:"-"`  // 状态机
-	EntityKey             string            `json:"-" gorm:"-" search:"-" copier:"-" vd:"-"`  // 业务实体Key
+	RecordLogHandler      RecordLogFunc     `json:"-" gorm:"-" search:"-" copier:"-" vd:"-"`  // 自定义操作日志
+	ReadOutsideTx         bool              `json:"-" gorm:"-" search:"-" copier:"-" vd:"-"`  // 查询不使用事务Db
+	BusinessCodes         []string          `json:"-" gorm:"-" search:"-" copier:"-" vd:"-"`  // 业务编码字段 | 恢复数据时校验唯一
+	ConcurrentPage        bool              `json:"-" gorm:"-" search:"-" copier:"-" vd:"-"`  // 分页查询并发执行统计和列表
+	SkipPermission        bool              `json:"-" gorm:"-" search:"-" copier:"-" vd:"-"`  // 查询不应用权限条件
+	DataScopePolicy       *DataScopePolicy  `json:"-" gorm:"-" search:"-" copier:"-" vd:"-"`  // 数据范围策略
+	entity                *T                // 绑定的业务实体
+	snapshot              *T                // 加载时的数据快照 | 用于区分新旧数据
+	domainEvents          []*domainEvent    // 待写入的领域事件
 }
 
-// 初始化模型
+// 初始化模型 | gin适配
 func NewBaseModel[T any](ctx *gin.Context, db *gorm.DB, tableName string, entity *T) BaseModel[T] {
 
 	// 前置校验
 	if ctx == nil {
 		panic("调用[NewBaseModel]入参, ctx为nil,请开发检查")
 	}
-	if ctx.Request == nil {
-		panic("调用[NewBaseModel]入参, ctx.Request is nil,请开发检查")
+	return NewBaseModelWithContext[T](ctx, db, tableName, entity)
+}
+
+// 使用模型上下文初始化模型 | HTTP场景传入*gin.Context,其他场景通过NewContext构造
+func NewBaseModelWithContext[T any](ctx ModelContext, db *gorm.DB, tableName string, entity *T) BaseModel[T] {
+
+	// 前置校验
+	if ctx == nil {
+		panic("调用[NewBaseModelWithContext]入参, ctx为nil,请开发检查")
+	}
+
+	// gin上下文使用请求的context提供截止时间和取消信号
+	var parent context.Context = ctx
+	if ginCtx, ok := ctx.(*gin.Context); ok {
+		parent = context.Background()
+		if ginCtx.Request != nil {
+			parent = ginCtx.Request.Context()
+		}
 	}
+	return newBaseModel(ctx, parent, db, tableName, entity)
+}
+
+// 初始化模型 | parent提供截止时间和取消信号
+func newBaseModel[T any](ctx ModelContext, parent context.Context, db *gorm.DB, tableName string, entity *T) BaseModel[T] {
+
+	// 前置校验
 	if entity == nil {
 		panic("调用[NewBaseModel]入参, 传入的entity为nil,请开发检查")
 	}
@@ -123,36 +179,25 @@ func NewBaseModel[T any](ctx *gin.Context, db *gorm.DB, tableName string, entity
 	userId, _ := ctx.Get("currUserId")
 	userName, _ := ctx.Get("currUserName")
 
-	// 基础模型赋值
-	entityKey := fmt.Sprintf("%p", entity) // 实体指针地址
+	// 基础模型赋值 | 直接持有业务实体指针,生命周期与实体一致
 	baseModel := BaseModel[T]{
 		Ctx:       ctx,
 		Db:        db,
 		TableName: tableName,
-		EntityKey: entityKey,
+		entity:    entity,
 	}
 
-	// 读取Context中的deadline
-	remaining := 5 * time.Minute
-	deadline, ok := ctx.Request.Context().Deadline()
-	if ok {
-		// 计算剩余时间
-		remaining = time.Until(deadline)
+	// 从Ctx中读取用户信息 | 没有用户时为空,不格式化为"<nil>"
+	if userId != nil {
+		baseModel.OperatorId = fmt.Sprintf("%v", userId)
+	}
+	if userName != nil {
+		baseModel.OperatorName = fmt.Sprintf("%v", userName)
 	}
 
-	// 将业务模型放到本地缓存中 | 过期时间: context中剩余时间或默认5分钟过期
-	localCache := localCache.NewCache()
-	localCache.Set(entityKey, entity, remaining)
-
-	// 从Ctx中读取用户信息
-	baseModel.OperatorId = fmt.Sprintf("%v", userId)
-	baseModel.OperatorName = fmt.Sprintf("%v", userName)
-
-	// 在db context 预埋用户信息
-	dbContet := context.Background()
-	dbContet = context.WithValue(dbContet, "currUserId", userId)
+	// 在db context 预埋用户信息 | 继承parent的截止时间和取消信号
+	dbContet := context.WithValue(parent, "currUserId", userId)
 	dbContet = context.WithValue(dbContet, "currUserName", userName)
-	// baseModel.Db.Statement.Context = dbContet
 	baseModel.Db = baseModel.Db.WithContext(dbContet)
 
 	// 给一个空默认搜索条件
@@ -173,6 +218,20 @@ func WithPermissionConditons[T any](conds ...SearchCondition) Option[T] {
 	}
 }
 
+// 数据范围策略 | 按当前用户的角色自动生成权限条件,与WithPermissionConditons同时生效
+func WithDataScopePolicy[T any](policy *DataScopePolicy) Option[T] {
+	return func(b *BaseModel[T]) {
+		b.DataScopePolicy = policy
+	}
+}
+
+// 不应用权限条件 | 系统任务等不区分用户的场景使用,默认条件仍然生效
+func WithoutPermission[T any]() Option[T] {
+	return func(b *BaseModel[T]) {
+		b.SkipPermission = true
+	}
+}
+
 // 注入Preload
 func WithPreloads[T any](preloads map[string][]any) Option[T] {
 	return func(b *BaseModel[T]) {
@@ -187,18 +246,50 @@ func WithCustomerOrder[T any](order string) Option[T] {
 	}
 }
 
+// 自定义操作日志记录 | 不设置时默认写入operation_log表
+func WithRecordLog[T any](fn RecordLogFunc) Option[T] {
+	return func(b *BaseModel[T]) {
+		b.RecordLogHandler = fn
+	}
+}
+
+// 查询不使用事务Db | 事务中的查询走独立连接,读不到事务中未提交的数据
+func WithReadOutsideTx[T any]() Option[T] {
+	return func(b *BaseModel[T]) {
+		b.ReadOutsideTx = true
+	}
+}
+
+// 业务编码字段 | 恢复已删除的数据时校验唯一
+func WithBusinessCodes[T any](fieldNames ...string) Option[T] {
+	return func(b *BaseModel[T]) {
+		b.BusinessCodes = fieldNames
+	}
+}
+
+// 分页查询并发执行统计和列表 | 事务中仍顺序执行
+func WithConcurrentPage[T any]() Option[T] {
+	return func(b *BaseModel[T]) {
+		b.ConcurrentPage = true
+	}
+}
+
 // ---------- 公共底层业务函数 ----------
 
 // 记录操作日志
 const LogTypeCreate string = "create"
 const LogTypeUpdate string = "update"
 const LogTypeDelete string = "delete"
+const LogTypeEvent string = "event"
+const LogTypeRestore string = "restore"
+const LogTypePurge string = "purge"
 
-// 记录操作日志 ｜ todo
+// 记录操作日志 | 优先使用WithRecordLog注入的实现
 func (b *BaseModel[T]) RecordLog(operatorType, operatorTypeName string, oldData, newData any) error {
-	// todo
-
-	return nil
+	if b.RecordLogHandler != nil {
+		return b.RecordLogHandler(b.Ctx, operatorType, operatorTypeName, oldData, newData)
+	}
+	return b.SaveOperationLog(operatorType, operatorTypeName, oldData, newData)
 }
 
 // 数据校验钩子函数
@@ -206,6 +297,11 @@ func (b *BaseModel[T]) Validate() error {
 	return nil
 }
 
+// 删除校验钩子函数 | 返回错误时不允许删除
+func (b *BaseModel[T]) ValidateDelete() error {
+	return nil
+}
+
 // 数据修复
 func (b *BaseModel[T]) Repair() error {
 	return nil
@@ -233,20 +329,11 @@ func (b *BaseModel[T]) CurrTime() time.Time {
 
 // 获取当前业务实体
 func (b *BaseModel[T]) GetCurrEntity() (*T, error) {
-	// 从本地缓存中读取
-	localCache := localCache.NewCache()
-	entity, exist := localCache.Get(b.EntityKey)
-	if !exist {
-		return nil, fmt.Errorf("本地缓存中没有[%v]对应的业务实体,请开发检查", b.EntityKey)
+	// 读取绑定的业务实体
+	if b.entity == nil {
+		return nil, fmt.Errorf("[%s]未绑定业务实体,请使用NewBaseModel或ReInit初始化", b.TableName)
 	}
-
-	// 断言判断
-	resEntity, ok := entity.(*T)
-	if !ok {
-		return nil, fmt.Errorf("本地缓存中没有[%v]对应的业务实体断言失败，请检查", b.EntityKey)
-	}
-
-	return resEntity, nil
+	return b.entity, nil
 }
 
 // 构造查询条件 | 这里不能传指针注意
@@ -279,7 +366,22 @@ func (b *BaseModel[T]) OrderByIdAsc() SearchCondition {
 	}
 }
 
-// 设置数据
+// 组合预加载条件 | 子表按Id正序
+func withPreloads(db *gorm.DB, preloads ...PreloadsType) *gorm.DB {
+	if len(preloads) == 0 {
+		return db
+	}
+	for key, vals := range preloads[0] {
+		// 组合where条件和order条件
+		vals = append(vals, func(db *gorm.DB) *gorm.DB {
+			return db.Order("id asc")
+		})
+		db = db.Preload(key, vals...)
+	}
+	return db
+}
+
+// 设置数据 | 没有编辑权限的字段(perm标记)在更新时校验
 func (b *BaseModel[T]) SetData(data any) (*T, error) {
 	// 读取业务实体 | 校验是否为空
 	entity, err := b.GetCurrEntity()
@@ -305,14 +407,16 @@ func (b *BaseModel[T]) Create() (*T, error) {
 		return nil, fmt.Errorf("[BASE]中业务实体为空,请开发检查")
 	}
 
-	// 执行创建操作
-	err = b.Tx().Omit(OmitUpdateFileds...).Create(entity).Error
-	if err != nil {
-		return nil, err
-	}
-
-	// 记录日志
-	err = b.RecordLog(LogTypeCreate, "新增", new(T), entity)
+	// 执行创建操作、写入领域事件、记录日志 | 同一个事务中执行
+	err = b.Transaction(func(tx *gorm.DB) error {
+		if err := b.createAggregate(tx, entity); err != nil {
+			return err
+		}
+		if err := b.FlushEvents(entity); err != nil {
+			return err
+		}
+		return b.RecordLog(LogTypeCreate, "新增", new(T), entity)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -322,13 +426,16 @@ func (b *BaseModel[T]) Create() (*T, error) {
 
 // 创建数据 | 使用传入对象作为存储对象
 func (b *BaseModel[T]) CreateWithData(data *T) (*T, error) {
-	// 执行创建操作
-	err := b.Tx().Omit(OmitUpdateFileds...).Create(data).Error
-	if err != nil {
-		return nil, err
-	}
-	// 记录日志
-	err = b.RecordLog(LogTypeCreate, "新增", new(T), data)
+	// 执行创建操作、写入领域事件、记录日志 | 同一个事务中执行
+	err := b.Transaction(func(tx *gorm.DB) error {
+		if err := b.createAggregate(tx, data); err != nil {
+			return err
+		}
+		if err := b.FlushEvents(data); err != nil {
+			return err
+		}
+		return b.RecordLog(LogTypeCreate, "新增", new(T), data)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -343,58 +450,102 @@ func (b *BaseModel[T]) Update() (*T, error) {
 		return nil, fmt.Errorf("[BASE]中业务实体为空,请开发检查")
 	}
 
-	// 执行更新操作
-	session := &gorm.Session{FullSaveAssociations: true, Context: b.Db.Statement.Context}
-	err = b.Tx().Omit(OmitCreateFileds...).Session(session).Clauses(clause.OnConflict{UpdateAll: true}).Save(entity).Error
+	// 读取旧数据
+	oldData, err := b.originData(entity)
 	if err != nil {
 		return nil, err
 	}
 
-	// 记录日志
-	// TODO 这里没有区分新旧数据，后续需要优化
-	err = b.RecordLog(LogTypeUpdate, "更新", entity, entity)
+	// 执行更新操作、写入领域事件、记录日志 | 同一个事务中执行
+	err = b.Transaction(func(tx *gorm.DB) error {
+		if err := b.updateAggregate(tx, entity, oldData); err != nil {
+			return err
+		}
+		if err := b.FlushEvents(entity); err != nil {
+			return err
+		}
+		return b.RecordLog(LogTypeUpdate, "更新", oldData, entity)
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	// 更新快照
+	b.takeSnapshot(entity)
 	return entity, nil
 }
 
 // 更新数据 | 使用传入对象作为更新对象
 func (b *BaseModel[T]) UpdateWithData(data *T) (*T, error) {
-	// 执行更新操作
-	session := &gorm.Session{FullSaveAssociations: true, Context: b.Db.Statement.Context}
-	err := b.Tx().Omit(OmitCreateFileds...).Session(session).Clauses(clause.OnConflict{UpdateAll: true}).Save(data).Error
+	// 读取旧数据
+	oldData, err := b.originData(data)
 	if err != nil {
 		return nil, err
 	}
 
-	// 记录日志
-	// TODO 这里没有区分新旧数据，后续需要优化
-	err = b.RecordLog(LogTypeUpdate, "更新", data, data)
+	// 执行更新操作、写入领域事件、记录日志 | 同一个事务中执行
+	err = b.Transaction(func(tx *gorm.DB) error {
+		if err := b.updateAggregate(tx, data, oldData); err != nil {
+			return err
+		}
+		if err := b.FlushEvents(data); err != nil {
+			return err
+		}
+		return b.RecordLog(LogTypeUpdate, "更新", oldData, data)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return data, nil
 }
 
-// 删除数据
+// 删除数据 | 应用默认条件和权限条件,任一数据不存在、无权限或删除校验不通过时整体不删除
 func (b *BaseModel[T]) Del(ids ...uint64) error {
-	// 执行删除操作
-	model := new(T)
-	err := b.Tx().Where("id in ?", ids).Delete(model).Error
-	if err != nil {
-		return err
+	if len(ids) == 0 {
+		return nil
 	}
-	return nil
+	return b.Transaction(func(tx *gorm.DB) error {
+		// 1. 查询要删除的数据 | 预加载一对多子表,用于记录日志
+		db, err := b.preloadHasMany(tx.
+			Scopes(b.dataScope). // 数据范围
+			Where(fmt.Sprintf("`%s`.`id` in ?", b.TableName), ids))
+		if err != nil {
+			return err
+		}
+		list := make([]*T, 0)
+		if err := db.Find(&list).Error; err != nil {
+			return err
+		}
+
+		// 2. 区分不存在和无权限的数据
+		if missing := missingIds(ids, list); len(missing) > 0 {
+			denied := make([]uint64, 0)
+			err := tx.Model(new(T)).Where("id in ?", missing).Pluck("id", &denied).Error
+			if err != nil {
+				return err
+			}
+			notFound := missingIds(missing, idsToEntities[T](denied))
+			msgs := make([]string, 0, 2)
+			if len(notFound) > 0 {
+				msgs = append(msgs, fmt.Sprintf("数据%v不存在", notFound))
+			}
+			if len(denied) > 0 {
+				msgs = append(msgs, fmt.Sprintf("数据%v无权限删除", denied))
+			}
+			return fmt.Errorf("[%s]%s,请检查", b.TableName, strings.Join(msgs, ","))
+		}
+
+		// 3. 删除校验,处理子表数据,执行删除操作并记录日志
+		_, err = b.deleteEntities(tx, list, "删除")
+		return err
+	})
 }
 
 // 统计数据条数 | 搜索条件: 默认条件,权限条件,搜索条件,拓展搜索条件
 func (b *BaseModel[T]) Count(conds ...SearchCondition) (int64, error) {
 	var total int64
-	err := b.Db.Debug().Model(new(T)).
-		Scopes(b.DefaultSearchConditon).
-		Scopes(b.PermissionConditons...).
+	err := b.readDb().Debug().Model(new(T)).
+		Scopes(b.dataScope).
 		Scopes(conds...).
 		Scopes(b.ClearOffset()).
 		Count(&total).Error
@@ -404,14 +555,22 @@ func (b *BaseModel[T]) Count(conds ...SearchCondition) (int64, error) {
 	return total, err
 }
 
-// 查询列表数据 | 搜索条件: 默认条件,权限条件,搜索条件,拓展搜索条件
+// 查询列表数据 | 搜索条件: 默认条件,权限条件,搜索条件,拓展搜索条件;不查询没有查看权限的字段
 func (b *BaseModel[T]) List(conds ...SearchCondition) ([]*T, error) {
 
 	// 组合查询条件
-	db := b.Db.Debug().
-		Scopes(b.DefaultSearchConditon).  // 默认条件
-		Scopes(b.PermissionConditons...). // 权限条件
-		Scopes(conds...)                  // 搜索条件
+	db := b.readDb().Debug().
+		Scopes(b.dataScope). // 数据范围
+		Scopes(conds...)     // 搜索条件
+
+	// 不查询没有查看权限的字段
+	hiddenColumns, err := b.hiddenColumns()
+	if err != nil {
+		return nil, err
+	}
+	if len(hiddenColumns) > 0 {
+		db = db.Omit(hiddenColumns...)
+	}
 
 	// 自定义排序规则
 	if b.CustomerOrder != "" {
@@ -433,7 +592,7 @@ func (b *BaseModel[T]) List(conds ...SearchCondition) ([]*T, error) {
 
 	// 执行查询
 	var list []*T
-	err := db.Find(&list).Error
+	err = db.Find(&list).Error
 	if err != nil {
 		return nil, err
 	}
@@ -441,6 +600,51 @@ func (b *BaseModel[T]) List(conds ...SearchCondition) ([]*T, error) {
 	return list, err
 }
 
+// 分批遍历数据 | 按id区间分批读取,不使用offset,回调返回错误时停止
+//
+// 条件中的排序和分页会被忽略,始终按id正序读取,每批单独预加载;
+// 用于数据修复等后台任务,读取完整数据,不按字段权限隐藏或脱敏,避免脱敏后的值被写回
+func (b *BaseModel[T]) Each(batchSize int, fn func(batch []*T) error, conds ...SearchCondition) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("[%s]分批遍历的批次大小必须大于0,请开发检查", b.TableName)
+	}
+
+	var lastId uint64
+	for {
+		// 组合查询条件 | 最后按id区间重置排序和分页
+		idColumn := clause.Column{Table: clause.CurrentTable, Name: "id"}
+		db := b.readDb().
+			Scopes(b.dataScope). // 数据范围
+			Scopes(conds...).    // 搜索条件
+			Scopes(func(db *gorm.DB) *gorm.DB {
+				delete(db.Statement.Clauses, "ORDER BY")
+				return db.Where(clause.Gt{Column: idColumn, Value: lastId}).
+					Order(clause.OrderByColumn{Column: idColumn}).
+					Offset(-1).Limit(batchSize)
+			})
+		db = withPreloads(db, b.Preloads)
+
+		// 执行查询
+		var batch []*T
+		err := db.Find(&batch).Error
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// 处理本批数据
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		lastId = entityId(batch[len(batch)-1])
+	}
+}
+
 // 加载数据
 func (b *BaseModel[T]) LoadData(cond SearchCondition, preloads ...PreloadsType) (*T, error) {
 
@@ -451,18 +655,9 @@ func (b *BaseModel[T]) LoadData(cond SearchCondition, preloads ...PreloadsType)
 	}
 
 	// 预加载查询
-	db := b.Db
-	if len(preloads) > 0 {
-		for key, vals := range preloads[0] {
-			// 组合where条件和order条件
-			vals = append(vals, func(db *gorm.DB) *gorm.DB {
-				return db.Order("id asc")
-			})
-			db = db.Preload(key, vals...)
-		}
-	}
+	db := withPreloads(b.readDb(), preloads...)
 
-	err = db.Scopes(cond).First(entity).Error
+	err = db.Scopes(b.dataScope).Scopes(cond).First(entity).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("[%s]查询的数据不存在,请检查", b.TableName)
@@ -470,6 +665,8 @@ func (b *BaseModel[T]) LoadData(cond SearchCondition, preloads ...PreloadsType)
 		return nil, err
 	}
 
+	// 记录快照
+	b.takeSnapshot(entity)
 	return entity, nil
 }
 
@@ -483,19 +680,10 @@ func (b *BaseModel[T]) LoadById(id uint64, preloads ...PreloadsType) (*T, error)
 	}
 
 	// 预加载查询
-	db := b.Db
-	if len(preloads) > 0 {
-		for key, vals := range preloads[0] {
-			// 组合where条件和order条件
-			vals = append(vals, func(db *gorm.DB) *gorm.DB {
-				return db.Order("id asc")
-			})
-			db = db.Preload(key, vals...)
-		}
-	}
+	db := withPreloads(b.readDb(), preloads...)
 
 	// 查询数据
-	err = db.Where("id = ?", id).First(entity).Error
+	err = db.Scopes(b.dataScope).Where("id = ?", id).First(entity).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("[%v]查询的数据不存在,请检查", b.TableName)
@@ -503,6 +691,8 @@ func (b *BaseModel[T]) LoadById(id uint64, preloads ...PreloadsType) (*T, error)
 		return entity, err
 	}
 
+	// 记录快照
+	b.takeSnapshot(entity)
 	return entity, nil
 }
 
@@ -518,45 +708,30 @@ func (b *BaseModel[T]) LoadByBusinessCode(filedName, filedValue string, preloads
 	}
 
 	// 预加载查询
-	db := b.Db
-	if len(preloads) > 0 {
-		for key, vals := range preloads[0] {
-			// 组合where条件和order条件
-			vals = append(vals, func(db *gorm.DB) *gorm.DB {
-				return db.Order("id asc")
-			})
-			db = db.Preload(key, vals...)
-		}
-	}
+	db := withPreloads(b.readDb(), preloads...)
 
 	// 查询数据
-	err = db.Where(fmt.Sprintf("%s = ?", filedName), filedValue).First(entity).Error
+	err = db.Scopes(b.dataScope).Where(fmt.Sprintf("%s = ?", filedName), filedValue).First(entity).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("[%v]对应业务Code[%s:%s]查询的数据不存在,请检查", b.TableName, filedName, filedValue)
 		}
 		return entity, err
 	}
+
+	// 记录快照
+	b.takeSnapshot(entity)
 	return entity, nil
 }
 
 // 根据Id查询数据
 func (b *BaseModel[T]) GetById(Id uint64, preloads ...PreloadsType) (*T, error) {
 	// 预加载查询
-	db := b.Db
-	if len(preloads) > 0 {
-		for key, vals := range preloads[0] {
-			// 组合where条件和order条件
-			vals = append(vals, func(db *gorm.DB) *gorm.DB {
-				return db.Order("id asc")
-			})
-			db = db.Preload(key, vals...)
-		}
-	}
+	db := withPreloads(b.readDb(), preloads...)
 
 	// 查询数据
 	data := new(T)
-	err := db.Where("id = ?", Id).First(data).Error
+	err := db.Scopes(b.dataScope).Where("id = ?", Id).First(data).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("查询的数据不存在,请检查")
@@ -570,19 +745,10 @@ func (b *BaseModel[T]) GetById(Id uint64, preloads ...PreloadsType) (*T, error)
 func (b *BaseModel[T]) GetByIds(Ids []uint64, preloads ...PreloadsType) ([]*T, error) {
 
 	// 预加载处理
-	db := b.Db
-	if len(preloads) > 0 {
-		for key, vals := range preloads[0] {
-			// 组合where条件和order条件
-			vals = append(vals, func(db *gorm.DB) *gorm.DB {
-				return db.Order("id asc")
-			})
-			db = db.Preload(key, vals...)
-		}
-	}
+	db := withPreloads(b.readDb(), preloads...)
 
 	// 组合查询条件
-	db = db.Where("id in ?", Ids)
+	db = db.Scopes(b.dataScope).Where("id in ?", Ids)
 
 	// 组合排序规则
 	if b.CustomerOrder != "" {
@@ -603,20 +769,11 @@ func (b *BaseModel[T]) GetByIds(Ids []uint64, preloads ...PreloadsType) ([]*T, e
 // 根据Ids查询数据
 func (b *BaseModel[T]) ListByIds(Ids []uint64, preloads ...PreloadsType) ([]*T, error) {
 	// 预加载处理
-	db := b.Db
-	if len(preloads) > 0 {
-		for key, vals := range preloads[0] {
-			// 组合where条件和order条件
-			vals = append(vals, func(db *gorm.DB) *gorm.DB {
-				return db.Order("id asc")
-			})
-			db = db.Preload(key, vals...)
-		}
-	}
+	db := withPreloads(b.readDb(), preloads...)
 
 	// 查询数据
 	dataList := make([]*T, 0)
-	err := db.Where("id in ?", Ids).Find(&dataList).Error
+	err := db.Scopes(b.dataScope).Where("id in ?", Ids).Find(&dataList).Error
 	if err != nil {
 		return nil, err
 	}
@@ -629,20 +786,11 @@ func (b *BaseModel[T]) ListByBusinessCode(filedName, filedValue string, preloads
 		return nil, err
 	}
 	// 预加载处理
-	db := b.Db
-	if len(preloads) > 0 {
-		for key, vals := range preloads[0] {
-			// 组合where条件和order条件
-			vals = append(vals, func(db *gorm.DB) *gorm.DB {
-				return db.Order("id asc")
-			})
-			db = db.Preload(key, vals...)
-		}
-	}
+	db := withPreloads(b.readDb(), preloads...)
 
 	// 查询数据
 	list := []*T{}
-	err := db.Where(fmt.Sprintf("%s = ?", filedName), filedValue).Find(&list).Error
+	err := db.Scopes(b.dataScope).Where(fmt.Sprintf("%s = ?", filedName), filedValue).Find(&list).Error
 	if err != nil {
 		return nil, err
 	}
@@ -659,20 +807,11 @@ func (b *BaseModel[T]) ListByBusinessCodes(filedName string, filedValues []strin
 	}
 
 	// 预加载处理
-	db := b.Db
-	if len(preloads) > 0 {
-		for key, vals := range preloads[0] {
-			// 组合where条件和order条件
-			vals = append(vals, func(db *gorm.DB) *gorm.DB {
-				return db.Order("id asc")
-			})
-			db = db.Preload(key, vals...)
-		}
-	}
+	db := withPreloads(b.readDb(), preloads...)
 
 	// filedValues 为空时，避免生成 in () 的无效 SQL
 	list := make([]*T, 0)
-	err := db.Where(fmt.Sprintf("%s in ?", filedName), filedValues).Find(&list).Error
+	err := db.Scopes(b.dataScope).Where(fmt.Sprintf("%s in ?", filedName), filedValues).Find(&list).Error
 	if err != nil {
 		return nil, err
 	}
@@ -685,7 +824,7 @@ func (m *BaseModel[T]) CountByBusinessCode(filedName, filedValue string) (int64,
 		return 0, err
 	}
 	var count int64
-	err := m.Db.Model(new(T)).Where(fmt.Sprintf("%s = ?", filedName), filedValue).Count(&count).Error
+	err := m.readDb().Model(new(T)).Scopes(m.dataScope).Where(fmt.Sprintf("%s = ?", filedName), filedValue).Count(&count).Error
 	if err != nil {
 		return 0, err
 	}
@@ -701,23 +840,96 @@ func (m *BaseModel[T]) CountByBusinessCodes(filedName string, filedValues []stri
 		return 0, fmt.Errorf("CountByBusinessCodes查询,业务编码列表不能为空")
 	}
 	var count int64
-	err := m.Db.Model(new(T)).Where(fmt.Sprintf("%s in ?", filedName), filedValues).Count(&count).Error
+	err := m.readDb().Model(new(T)).Scopes(m.dataScope).Where(fmt.Sprintf("%s in ?", filedName), filedValues).Count(&count).Error
 	if err != nil {
 		return 0, err
 	}
 	return count, nil
 }
 
-// MaxId 获取最大ID
+// MaxId 获取最大ID | 全表范围,不应用默认条件和权限条件
 func (m *BaseModel[T]) MaxId() (int64, error) {
 	var maxId int64
-	err := m.Db.Model(new(T)).Select("max(id)").Scan(&maxId).Error
+	err := m.readDb().Model(new(T)).Select("max(id)").Scan(&maxId).Error
 	if err != nil {
 		return 0, err
 	}
 	return maxId, nil
 }
 
+// 数据范围 | 默认条件、权限条件和数据范围策略,所有查询统一应用;开启WithoutPermission时只应用默认条件
+//
+// 唯一校验(CheckBusinessCodeExist、CheckUniqueKeysExist等)需要在全表范围内校验,不应用数据范围
+func (b *BaseModel[T]) dataScope(db *gorm.DB) *gorm.DB {
+	if b.DefaultSearchConditon != nil {
+		db = b.DefaultSearchConditon(db)
+	}
+	if b.SkipPermission {
+		return db
+	}
+	for _, cond := range b.PermissionConditons {
+		db = cond(db)
+	}
+	if b.DataScopePolicy != nil {
+		db = b.policyCondition(db)
+	}
+	return db
+}
+
+// 记录数据快照 | 加载数据后调用,更新时作为旧数据
+func (b *BaseModel[T]) takeSnapshot(entity *T) {
+	b.snapshot = nil
+	snapshot := new(T)
+	cloneValue(reflect.ValueOf(snapshot).Elem(), reflect.ValueOf(entity).Elem())
+	b.snapshot = snapshot
+}
+
+// 读取旧数据 | 当前实体优先使用加载时的快照,否则按Id重新查询(包含一对多子表),应用默认条件和权限条件
+func (b *BaseModel[T]) originData(data *T) (*T, error) {
+	entity, _ := b.GetCurrEntity()
+	if data == entity && b.snapshot != nil && entityId(b.snapshot) == entityId(data) {
+		return b.snapshot, nil
+	}
+
+	// 未落库的数据没有旧数据
+	id := entityId(data)
+	if id == 0 {
+		return nil, nil
+	}
+
+	// 预加载一对多子表
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return nil, err
+	}
+	db := b.Tx()
+	for _, rel := range modelSchema.Relationships.HasMany {
+		db = db.Preload(rel.Name, func(db *gorm.DB) *gorm.DB {
+			return db.Order("id asc")
+		})
+	}
+
+	// 查询旧数据 | 不在数据范围内时不允许更新
+	oldData := new(T)
+	err = db.Where("id = ?", id).Scopes(b.dataScope).First(oldData).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("[%s]数据[%d]不存在或无权限,请检查", b.TableName, id)
+		}
+		return nil, err
+	}
+	return oldData, nil
+}
+
+// 解析模型结构
+func (b *BaseModel[T]) parseSchema() (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: b.Db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
 // 重置上下文和Db
 func (b *BaseModel[T]) ReInit(entity *T, baseModel *BaseModel[T]) error {
 	if b.Ctx == nil || b.Db == nil {
@@ -726,20 +938,31 @@ func (b *BaseModel[T]) ReInit(entity *T, baseModel *BaseModel[T]) error {
 	baseModel.Ctx = b.Ctx
 	baseModel.Db = b.Db
 	baseModel.TableName = b.TableName
-	baseModel.EntityKey = fmt.Sprintf("%p", entity) // 实体指针地址
+	baseModel.entity = entity
 	return nil
 }
 
+// 绑定查询出的数据 | 使数据可以调用模型能力,如删除校验钩子中查询数据
+func (b *BaseModel[T]) bindEntity(item *T) {
+	field := reflect.ValueOf(item).Elem().FieldByName("BaseModel")
+	if !field.IsValid() || !field.CanAddr() {
+		return
+	}
+	if baseModel, ok := field.Addr().Interface().(*BaseModel[T]); ok {
+		_ = b.ReInit(item, baseModel)
+	}
+}
+
 //	校验业务单号是否存在
 //
 // 如果当前业务实体Id存在(意味着当前数据已经落库,会跳过当前)
-// true 存在 false 不存在
+// true 存在 false 不存在 | 全表范围校验,不应用权限条件
 func (b *BaseModel[T]) CheckBusinessCodeExist(filedName, businessCode string) (bool, error) {
 	if err := validateSafeColumnName(filedName); err != nil {
 		return true, err
 	}
 	ids := []uint64{}
-	err := b.Db.Model(new(T)).Select("id").Where(fmt.Sprintf("%s = ?", filedName), businessCode).Find(&ids).Error
+	err := b.readDb().Model(new(T)).Select("id").Where(fmt.Sprintf("%s = ?", filedName), businessCode).Find(&ids).Error
 	if err != nil {
 		return true, err
 	}
@@ -781,7 +1004,7 @@ func (b *BaseModel[T]) CheckBusinessCodesExist(filedName string, values []string
 	// 查询DB数据
 	dbFileds := []string{}
 	model := new(T)
-	err := b.Db.Model(model).Select(filedName).Where(fmt.Sprintf("%s in ?", filedName), values).Find(&dbFileds).Error
+	err := b.readDb().Model(model).Select(filedName).Where(fmt.Sprintf("%s in ?", filedName), values).Find(&dbFileds).Error
 	if err != nil {
 		return res, err
 	}
@@ -803,11 +1026,11 @@ func (b *BaseModel[T]) CheckBusinessCodesExist(filedName string, values []string
 //	校验唯一键是否存在 | 单条校验
 //
 // 如果当前业务实体Id存在(意味着当前数据已经落库,会跳过当前)
-// true 存在 false 不存在
+// true 存在 false 不存在 | 全表范围校验,不应用权限条件
 func (b *BaseModel[T]) CheckUniqueKeysExist(filedNames []string, values []string) (bool, error) {
 	ids := []uint64{}
 	stringBuilder := fmt.Sprintf("(%v) = ?", strings.Join(filedNames, ","))
-	err := b.Db.Model(new(T)).Where(stringBuilder, values).Find(&ids).Error
+	err := b.readDb().Model(new(T)).Where(stringBuilder, values).Find(&ids).Error
 	if err != nil {
 		return true, err
 	}
@@ -853,7 +1076,7 @@ func (b *BaseModel[T]) CheckUniqueKeysExistBatch(filedNames []string, values [][
 
 	// 执行查询
 	list := []*itemData{}
-	err := b.Db.Model(new(T)).Select(selectBuilder).Where(whereBuilder, values).Find(&list).Error
+	err := b.readDb().Model(new(T)).Select(selectBuilder).Where(whereBuilder, values).Find(&list).Error
 	if err != nil {
 		return res, err
 	}
@@ -931,65 +1154,36 @@ func (b *BaseModel[T]) EventExecution(initStatus, event, eventZhName string, arg
 	copier.Copy(oldData, entity)
 
 	// 执行事件 | 注意状态没有变化是允许的
-	ctx := b.Ctx.Request.Context()
+	ctx := b.Db.Statement.Context
 	err = b.StatesMachine.Event(ctx, event, args)
 	noTransitionError := fsm.NoTransitionError{Err: nil}
 	if err != nil && !errors.Is(err, noTransitionError) {
 		return fmt.Errorf("业务实体[%s]执行事件[%s]失败[%s],请开发检查", b.TableName, eventZhName, err.Error())
 	}
 
-	// 保存最新状态
-	err = b.Tx().Save(entity).Error
-	if err != nil {
-		return fmt.Errorf("业务实体[%s]保存最终状态失败,请开发检查", b.TableName)
-	}
-
-	// 记录操作日志
-	b.RecordLog(event, eventZhName, oldData, entity)
-	return nil
-}
-
-// ---------- 事务函数 ----------
-
-// 获取事务Db
-func (m *BaseModel[T]) Tx() *gorm.DB {
-	db, exist := m.Ctx.Get("txDb")
-	if exist && db != nil {
-		return db.(*gorm.DB)
-	}
-	return m.Db
-}
-
-// 开启事务
-func (m *BaseModel[T]) Transaction(fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
-
-	// 防止重复开启事务
-	_, exist := m.Ctx.Get("txDb")
-	if exist {
-		return fmt.Errorf("事务已开启,不要重复开启事务,请开发检查")
-	}
-
-	// 开启事务
-	err := m.Db.Transaction(func(tx *gorm.DB) error {
-		// 预埋事务Db
-		m.Ctx.Set("txDb", tx)
+	// 保存最新状态、写入领域事件、记录操作日志 | 同一个事务中执行
+	return b.Transaction(func(tx *gorm.DB) error {
+		err := b.saveWithVersion(tx, entity)
+		if err != nil {
+			if errors.Is(err, ErrVersionConflict) {
+				return err
+			}
+			return fmt.Errorf("业务实体[%s]保存最终状态失败,请开发检查", b.TableName)
+		}
 
-		// 执行事务逻辑代码
-		if err := fc(tx); err != nil {
-			return err
+		// 写入领域事件
+		err = b.FlushEvents(entity)
+		if err != nil {
+			return fmt.Errorf("业务实体[%s]写入领域事件失败[%s],请开发检查", b.TableName, err.Error())
 		}
 
-		// 回收事务Db
-		m.Ctx.Set("txDb", nil)
+		// 记录操作日志
+		err = b.RecordLog(event, eventZhName, oldData, entity)
+		if err != nil {
+			return fmt.Errorf("业务实体[%s]记录操作日志失败[%s],请开发检查", b.TableName, err.Error())
+		}
 		return nil
-	}, opts...)
-	return err
-}
-
-// 检查是否已经开启事务
-func (m *BaseModel[T]) IsInTransaction() bool {
-	_, exist := m.Ctx.Get("txDb")
-	return exist
+	})
 }
 
 // ---------- 底层钩子 ----------
@@ -1102,7 +1296,7 @@ func (b *BaseModel[T]) BeforeDelete(tx *gorm.DB) (err error) {
 // ---------- Ctx缓存 ----------
 
 // 设置缓存，增加防并发锁
-func GetDataWithCtxCache[T any](ctx *gin.Context, key string, fn func() (T, error)) (T, error) {
+func GetDataWithCtxCache[T any](ctx ModelContext, key string, fn func() (T, error)) (T, error) {
 
 	// 使用互斥锁防止并发
 	var mu sync.Mutex
@@ -1128,7 +1322,7 @@ func GetDataWithCtxCache[T any](ctx *gin.Context, key string, fn func() (T, erro
 }
 
 // 更新缓存
-func ResetDataWithCtxCache[T any](ctx *gin.Context, key string, data T) {
+func ResetDataWithCtxCache[T any](ctx ModelContext, key string, data T) {
 	// 使用互斥锁防止并发
 	var mu sync.Mutex
 	mu.Lock()
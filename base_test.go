@@ -0,0 +1,743 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jianyuezhexue/base/outbox"
+	"github.com/looplab/fsm"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type testOrder struct {
+	BaseModel[testOrder]
+	OrderId   string             `json:"orderId" comment:"SO号"`
+	Status    int                `json:"status" comment:"状态"`
+	Details   []*testOrderDetail `json:"details" gorm:"foreignKey:OrderId;references:OrderId" onDelete:"cascade" comment:"明细"`
+	DeletedBy string             `json:"-" gorm:"<-:update"` // 删除人
+}
+
+func (m *testOrder) TableName() string {
+	return "test_order"
+}
+
+func (m *testOrder) ValidateDelete() error {
+	if m.Status == 9 {
+		return errors.New("已关闭的订单不允许删除")
+	}
+	return nil
+}
+
+type testOrderDetail struct {
+	BaseModel[testOrderDetail]
+	OrderId string `json:"orderId" comment:"SO号"`
+	SkuCode string `json:"skuCode" comment:"SKU编码"`
+}
+
+func (m *testOrderDetail) TableName() string {
+	return "test_order_detail"
+}
+
+type testInvoice struct {
+	BaseModel[testInvoice]
+	Title   string              `json:"title" comment:"抬头"`
+	Address *testInvoiceAddress `json:"address" gorm:"foreignKey:InvoiceId" comment:"寄送地址"`
+}
+
+func (m *testInvoice) TableName() string {
+	return "test_invoice"
+}
+
+type testInvoiceAddress struct {
+	BaseModel[testInvoiceAddress]
+	InvoiceId uint64 `json:"invoiceId" comment:"发票Id"`
+	Address   string `json:"address" comment:"地址"`
+}
+
+func (m *testInvoiceAddress) TableName() string {
+	return "test_invoice_address"
+}
+
+// DryRun连接池 | 支持开启事务,不连接数据库,记录开启、提交和回滚事务的次数
+type dryRunPool struct {
+	begins    int
+	commits   int
+	rollbacks int
+}
+
+func (p *dryRunPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errors.New("dry run")
+}
+func (p *dryRunPool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return nil, errors.New("dry run")
+}
+func (p *dryRunPool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return nil, errors.New("dry run")
+}
+func (p *dryRunPool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return nil
+}
+func (p *dryRunPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	p.begins++
+	return &dryRunTx{pool: p}, nil
+}
+
+// DryRun事务 | 嵌套事务使用保存点
+type dryRunTx struct {
+	pool *dryRunPool
+}
+
+func (tx *dryRunTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return tx.pool.PrepareContext(ctx, query)
+}
+func (tx *dryRunTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return tx.pool.ExecContext(ctx, query, args...)
+}
+func (tx *dryRunTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return tx.pool.QueryContext(ctx, query, args...)
+}
+func (tx *dryRunTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return nil
+}
+func (tx *dryRunTx) Commit() error {
+	tx.pool.commits++
+	return nil
+}
+func (tx *dryRunTx) Rollback() error {
+	tx.pool.rollbacks++
+	return nil
+}
+
+// 实例化DryRun模型 | 返回执行过的SQL
+func newDryRunOrder(t *testing.T, opts ...Option[testOrder]) (*testOrder, *[]string) {
+	db, sqls := newDryRunDb(t)
+	entity := &testOrder{}
+	entity.BaseModel = NewBaseModelWithContext(NewContext(context.Background(), "1", "张三"), db, entity.TableName(), entity)
+	for _, fc := range opts {
+		fc(&entity.BaseModel)
+	}
+	return entity, sqls
+}
+
+// DryRun数据库 | 记录执行的SQL
+func newDryRunDb(t *testing.T) (*gorm.DB, *[]string) {
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: &dryRunPool{}, SkipInitializeWithVersion: true}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		NamingStrategy:         schema.NamingStrategy{SingularTable: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 记录SQL
+	sqls := make([]string, 0)
+	record := func(tx *gorm.DB) {
+		sqls = append(sqls, strings.TrimSpace(tx.Statement.SQL.String()))
+	}
+	_ = db.Callback().Query().After("gorm:query").Register("test:record", record)
+	_ = db.Callback().Create().After("gorm:create").Register("test:record", record)
+	_ = db.Callback().Update().After("gorm:update").Register("test:record", record)
+	_ = db.Callback().Delete().After("gorm:delete").Register("test:record", record)
+	return db, &sqls
+}
+
+func TestEach(t *testing.T) {
+	order, sqls := newDryRunOrder(t)
+
+	// 搜索条件中的排序和分页被忽略
+	cond := func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ?", 1).Order("order_id desc").Offset(20).Limit(10)
+	}
+	err := order.Each(100, func(batch []*testOrder) error {
+		return nil
+	}, cond)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"SELECT * FROM `test_order` WHERE status = ? AND `test_order`.`id` > ? AND `test_order`.`deleted_at` IS NULL ORDER BY `test_order`.`id` LIMIT ?",
+	}, *sqls)
+
+	// 批次大小必须大于0
+	assert.NotNil(t, order.Each(0, func(batch []*testOrder) error { return nil }))
+}
+
+func TestCreateBatch(t *testing.T) {
+	// 模拟第2条数据写日志失败
+	recordLog := func(ctx ModelContext, operatorType, operatorTypeName string, oldData, newData any) error {
+		if newData.(*testOrder).OrderId == "SO2" {
+			return errors.New("模拟失败")
+		}
+		return nil
+	}
+	order, sqls := newDryRunOrder(t, WithRecordLog[testOrder](recordLog))
+
+	items := []*testOrder{{OrderId: "SO1"}, {OrderId: "SO2"}, {OrderId: "SO3"}}
+	result, err := order.CreateBatch(items, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Success)
+	assert.Equal(t, 1, result.Failed)
+	assert.Nil(t, result.Items[0].Err)
+	assert.NotNil(t, result.Items[1].Err)
+	assert.Nil(t, result.Items[2].Err)
+	assert.Len(t, result.FailedItems(), 1)
+	assert.NotNil(t, result.Err())
+
+	// 第一批整批插入失败后逐条重试,第二批整批插入
+	assert.Len(t, *sqls, 4)
+	assert.Contains(t, (*sqls)[0], "VALUES (?,?,?,?,?,?),(?,?,?,?,?,?)")
+	assert.Equal(t, "张三", items[0].CreateByName)
+
+	// 批次大小必须大于0
+	_, err = order.CreateBatch(items, 0)
+	assert.NotNil(t, err)
+}
+
+func TestCreateBatchDetails(t *testing.T) {
+	logs := make([]string, 0)
+	recordLog := func(ctx ModelContext, operatorType, operatorTypeName string, oldData, newData any) error {
+		logs = append(logs, reflect.TypeOf(newData).String())
+		return nil
+	}
+	order, sqls := newDryRunOrder(t, WithRecordLog[testOrder](recordLog))
+
+	// 批量新增时子表数据回填外键并记录日志
+	items := []*testOrder{{OrderId: "SO1", Details: []*testOrderDetail{{SkuCode: "SKU1"}}}}
+	result, err := order.CreateBatch(items, 2)
+	assert.Nil(t, err)
+	assert.Nil(t, result.Err())
+	assert.Equal(t, "SO1", items[0].Details[0].OrderId)
+	assert.True(t, strings.HasPrefix((*sqls)[0], "INSERT INTO `test_order`"))
+	assert.NotContains(t, (*sqls)[0], "test_order_detail")
+	assert.True(t, strings.HasPrefix((*sqls)[len(*sqls)-1], "INSERT INTO `test_order_detail`"))
+	assert.Equal(t, []string{"*base.testOrderDetail", "*base.testOrder"}, logs)
+
+	// 新增时不查询数据库中同业务编码的子表数据
+	for _, sql := range *sqls {
+		assert.False(t, strings.HasPrefix(sql, "SELECT"), sql)
+	}
+
+	// 新增时子表数据不能带Id
+	data := &testOrder{OrderId: "SO2", Details: []*testOrderDetail{{BaseModel: BaseModel[testOrderDetail]{Id: 99}}}}
+	assert.NotNil(t, order.createAssociations(order.Db, data))
+}
+
+func TestUpsertByBusinessCodes(t *testing.T) {
+	withPermission := WithPermissionConditons[testOrder](func(db *gorm.DB) *gorm.DB {
+		return db.Where("create_by = ?", "1")
+	})
+	order, sqls := newDryRunOrder(t, withPermission)
+
+	items := []*testOrder{{OrderId: "SO1", Status: 1}, {OrderId: "SO2", Status: 2}}
+	inserted, err := order.UpsertByBusinessCodes("order_id", items)
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, true}, inserted)
+
+	// 按数据范围查询已存在数据 -> 校验数据范围外的业务编码 -> 新增或更新 -> 回填Id -> 记录日志
+	assert.Len(t, *sqls, 6)
+	assert.Equal(t, "SELECT * FROM `test_order` WHERE order_id in (?,?) AND create_by = ?", (*sqls)[0])
+	assert.Equal(t, "SELECT `order_id` FROM `test_order` WHERE order_id in (?,?)", (*sqls)[1])
+	upsertSQL := (*sqls)[2]
+	assert.Contains(t, upsertSQL, "ON DUPLICATE KEY UPDATE `status`=VALUES(`status`)")
+	assert.Contains(t, upsertSQL, "`update_by`=?")
+	assert.NotContains(t, upsertSQL, "`deleted_at`=")
+	assert.NotContains(t, upsertSQL, "`deleted_by`=")
+	assert.NotContains(t, upsertSQL, "`create_by`=")
+	assert.NotContains(t, upsertSQL, "`order_id`=VALUES")
+
+	// 字段名非法
+	_, err = order.UpsertByBusinessCode("order_id;drop", items[0])
+	assert.NotNil(t, err)
+
+	// 同一批次业务编码重复
+	*sqls = (*sqls)[:0]
+	_, err = order.UpsertByBusinessCodes("order_id", []*testOrder{{OrderId: "SO1"}, {OrderId: "SO1"}})
+	assert.NotNil(t, err)
+	assert.Empty(t, *sqls)
+
+	// 业务编码在数据范围外已存在时不允许更新
+	_ = order.Db.Callback().Query().After("gorm:query").Register("test:codes", func(tx *gorm.DB) {
+		if codes, ok := tx.Statement.Dest.(*[]string); ok {
+			*codes = []string{"SO1"}
+		}
+	})
+	_, err = order.UpsertByBusinessCodes("order_id", []*testOrder{{OrderId: "SO1"}, {OrderId: "SO2"}})
+	assert.ErrorContains(t, err, "无权限")
+	assert.Len(t, *sqls, 2)
+
+	// 业务编码对应的数据已软删除时不自动恢复
+	*sqls = (*sqls)[:0]
+	_ = order.Db.Callback().Query().After("gorm:query").Register("test:olds", func(tx *gorm.DB) {
+		if olds, ok := tx.Statement.Dest.(*[]*testOrder); ok {
+			old := &testOrder{OrderId: "SO1"}
+			old.Id = 1
+			old.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			*olds = []*testOrder{old}
+		}
+	})
+	_, err = order.UpsertByBusinessCode("order_id", &testOrder{OrderId: "SO1"})
+	assert.ErrorContains(t, err, "请先恢复")
+	assert.Len(t, *sqls, 1)
+}
+
+func TestUpdateWhere(t *testing.T) {
+	withPermission := WithPermissionConditons[testOrder](func(db *gorm.DB) *gorm.DB {
+		return db.Where("create_by = ?", "1")
+	})
+	logs := make([]any, 0)
+	withRecordLog := WithRecordLog[testOrder](func(ctx ModelContext, operatorType, operatorTypeName string, oldData, newData any) error {
+		logs = append(logs, oldData, newData)
+		return nil
+	})
+	order, sqls := newDryRunOrder(t, withPermission, withRecordLog)
+
+	// 字段名校验
+	_, err := order.UpdateWhere(func(db *gorm.DB) *gorm.DB { return db }, map[string]any{"status;drop": 1})
+	assert.NotNil(t, err)
+	_, err = order.UpdateWhere(func(db *gorm.DB) *gorm.DB { return db }, map[string]any{"create_by": "2"})
+	assert.NotNil(t, err)
+	_, err = order.UpdateWhere(func(db *gorm.DB) *gorm.DB { return db }, map[string]any{"deleted_at": nil})
+	assert.NotNil(t, err)
+	_, err = order.UpdateWhere(func(db *gorm.DB) *gorm.DB { return db }, map[string]any{"deleted_by": ""})
+	assert.NotNil(t, err)
+
+	// DryRun不返回数据,查询Id时填充
+	_ = order.Db.Callback().Query().After("gorm:query").Register("test:ids", func(tx *gorm.DB) {
+		if ids, ok := tx.Statement.Dest.(*[]uint64); ok {
+			*ids = []uint64{1, 2}
+		}
+	})
+
+	// 查询Id时应用权限条件 -> 按Id更新并维护更新人信息 -> 记录日志
+	cond := func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ?", 0).Offset(10).Limit(10)
+	}
+	_, err = order.UpdateWhere(cond, map[string]any{"status": 9})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"SELECT `test_order`.`id` FROM `test_order` WHERE create_by = ? AND status = ? AND `test_order`.`deleted_at` IS NULL",
+		"UPDATE `test_order` SET `status`=?,`update_by`=?,`update_by_name`=?,`updated_at`=? WHERE id in (?,?) AND `test_order`.`deleted_at` IS NULL",
+	}, *sqls)
+	changes := map[string]any{"status": 9}
+	assert.Equal(t, []any{nil, &bulkChange{Id: 1, Changes: changes}, nil, &bulkChange{Id: 2, Changes: changes}}, logs)
+
+	// 删除与Del一样查询数据 -> 级联删除子表 -> 软删除 -> 逐条记录日志
+	orders := []*testOrder{
+		{BaseModel: BaseModel[testOrder]{Id: 1}, OrderId: "SO1", Details: []*testOrderDetail{{BaseModel: BaseModel[testOrderDetail]{Id: 11}}}},
+		{BaseModel: BaseModel[testOrder]{Id: 2}, OrderId: "SO2"},
+	}
+	_ = order.Db.Callback().Query().After("gorm:query").Register("test:list", func(tx *gorm.DB) {
+		if list, ok := tx.Statement.Dest.(*[]*testOrder); ok {
+			*list = orders
+		}
+	})
+	*sqls, logs = (*sqls)[:0], logs[:0]
+	_, err = order.DeleteWhere(cond)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"SELECT * FROM `test_order` WHERE create_by = ? AND status = ? AND `test_order`.`deleted_at` IS NULL",
+		"UPDATE `test_order_detail` SET `deleted_at`=? WHERE id in (?) AND `test_order_detail`.`deleted_at` IS NULL",
+		"UPDATE `test_order` SET `deleted_at`=?,`deleted_by`=? WHERE id in (?,?) AND `test_order`.`deleted_at` IS NULL",
+	}, *sqls)
+	assert.Len(t, logs, 6)
+	assert.Equal(t, orders[0], logs[2])
+	assert.Equal(t, orders[1], logs[4])
+
+	// 删除校验不通过时整体不删除
+	orders[1].Status = 9
+	*sqls = (*sqls)[:0]
+	_, err = order.DeleteWhere(cond)
+	assert.ErrorContains(t, err, "不允许删除")
+	assert.Len(t, *sqls, 1)
+}
+
+type testVersionOrder struct {
+	BaseModel[testVersionOrder]
+	Status  int   `json:"status" comment:"状态"`
+	Version int64 `json:"version" lock:"version" comment:"版本号"`
+}
+
+func (m *testVersionOrder) TableName() string {
+	return "test_version_order"
+}
+
+func TestUpdateWhereVersion(t *testing.T) {
+	db, sqls := newDryRunDb(t)
+	order := &testVersionOrder{}
+	order.BaseModel = NewBaseModelWithContext(NewContext(context.Background(), "1", "张三"), db, order.TableName(), order)
+	order.RecordLogHandler = func(ctx ModelContext, operatorType, operatorTypeName string, oldData, newData any) error {
+		return nil
+	}
+	_ = order.Db.Callback().Query().After("gorm:query").Register("test:ids", func(tx *gorm.DB) {
+		if ids, ok := tx.Statement.Dest.(*[]uint64); ok {
+			*ids = []uint64{1}
+		}
+	})
+
+	// 开启乐观锁时递增版本号
+	_, err := order.UpdateWhere(func(db *gorm.DB) *gorm.DB { return db }, map[string]any{"status": 9})
+	assert.Nil(t, err)
+	assert.Contains(t, (*sqls)[1], "`version`=`version` + 1")
+
+	// 版本号由框架维护,不允许直接修改
+	_, err = order.UpdateWhere(func(db *gorm.DB) *gorm.DB { return db }, map[string]any{"version": 1})
+	assert.NotNil(t, err)
+}
+
+func TestSoftDelete(t *testing.T) {
+	order, sqls := newDryRunOrder(t)
+
+	// 软删除记录删除人
+	_, err := order.softDelete(order.Db, []uint64{1, 2}, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE `test_order` SET `deleted_at`=?,`deleted_by`=? WHERE id in (?,?) AND `test_order`.`deleted_at` IS NULL", (*sqls)[0])
+
+	// 回收站
+	_, err = order.ListTrashed()
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM `test_order` WHERE `test_order`.`deleted_at` is not null ORDER BY `test_order`.`deleted_at` desc", (*sqls)[1])
+
+	// 恢复不存在的数据
+	assert.NotNil(t, order.Restore(1))
+
+	// 彻底删除超过保留期的数据
+	_, err = order.Purge(30 * 24 * time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT `id` FROM `test_order` WHERE `test_order`.`deleted_at` < ?", (*sqls)[len(*sqls)-1])
+}
+
+func TestDel(t *testing.T) {
+	withPermission := WithPermissionConditons[testOrder](func(db *gorm.DB) *gorm.DB {
+		return db.Where("create_by = ?", "1")
+	})
+	order, sqls := newDryRunOrder(t, withPermission)
+
+	// 查询要删除的数据时应用权限条件,查不到时整体不删除
+	err := order.Del(1, 2)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "数据[1 2]不存在")
+	assert.Equal(t, []string{
+		"SELECT * FROM `test_order` WHERE `test_order`.`id` in (?,?) AND create_by = ? AND `test_order`.`deleted_at` IS NULL",
+		"SELECT `id` FROM `test_order` WHERE id in (?,?) AND `test_order`.`deleted_at` IS NULL",
+	}, *sqls)
+}
+
+func TestDeleteAssociations(t *testing.T) {
+	logs := make([]string, 0)
+	recordLog := func(ctx ModelContext, operatorType, operatorTypeName string, oldData, newData any) error {
+		logs = append(logs, entityTableName(oldData)+":"+operatorTypeName)
+		return nil
+	}
+	order, sqls := newDryRunOrder(t, WithRecordLog[testOrder](recordLog))
+	list := []*testOrder{{OrderId: "SO1", Details: []*testOrderDetail{{BaseModel: BaseModel[testOrderDetail]{Id: 11}}, {BaseModel: BaseModel[testOrderDetail]{Id: 12}}}}}
+
+	// 级联软删除子表并记录日志 | 子表未声明删除人字段时只写删除时间
+	assert.Nil(t, order.deleteAssociations(order.Db, list, time.Now()))
+	assert.Equal(t, []string{"UPDATE `test_order_detail` SET `deleted_at`=? WHERE id in (?,?) AND `test_order_detail`.`deleted_at` IS NULL"}, *sqls)
+	assert.Equal(t, []string{"test_order_detail:级联删除", "test_order_detail:级联删除"}, logs)
+
+	// 没有子表数据不处理
+	assert.Nil(t, order.deleteAssociations(order.Db, []*testOrder{{OrderId: "SO2"}}, time.Now()))
+	assert.Len(t, *sqls, 1)
+}
+
+func TestRestoreAssociations(t *testing.T) {
+	logs := make([]string, 0)
+	recordLog := func(ctx ModelContext, operatorType, operatorTypeName string, oldData, newData any) error {
+		logs = append(logs, entityTableName(newData, oldData)+":"+operatorTypeName)
+		return nil
+	}
+	order, sqls := newDryRunOrder(t, WithRecordLog[testOrder](recordLog))
+	_ = order.Db.Callback().Query().After("gorm:query").Register("test:children", func(tx *gorm.DB) {
+		if ids, ok := tx.Statement.Dest.(*[]uint64); ok && tx.Statement.Table == "test_order_detail" {
+			*ids = []uint64{11}
+		}
+		if details, ok := tx.Statement.Dest.(*[]*testOrderDetail); ok {
+			*details = []*testOrderDetail{{BaseModel: BaseModel[testOrderDetail]{Id: 11}, OrderId: "SO1"}}
+		}
+	})
+
+	// 恢复与主表同一时间级联删除的子表数据
+	deleted := &testOrder{OrderId: "SO1"}
+	deleted.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	assert.Nil(t, order.restoreAssociations(order.Db, []*testOrder{deleted}))
+	assert.Equal(t, []string{
+		"SELECT * FROM `test_order_detail` WHERE `order_id` = ? AND `deleted_at` = ? ORDER BY id asc",
+		"UPDATE `test_order_detail` SET `deleted_at`=? WHERE id in (?)",
+	}, *sqls)
+	assert.Equal(t, []string{"test_order_detail:级联恢复"}, logs)
+
+	// 未删除的数据不处理
+	assert.Nil(t, order.restoreAssociations(order.Db, []*testOrder{{OrderId: "SO2"}}))
+	assert.Len(t, *sqls, 2)
+
+	// 彻底删除超过保留期的子表数据
+	*sqls, logs = (*sqls)[:0], logs[:0]
+	assert.Nil(t, order.purgeAssociations(order.Db, time.Now()))
+	assert.Equal(t, []string{
+		"SELECT `id` FROM `test_order_detail` WHERE `deleted_at` < ?",
+		"DELETE FROM `test_order_detail` WHERE id in (?)",
+	}, *sqls)
+	assert.Equal(t, []string{"test_order_detail:彻底删除"}, logs)
+}
+
+func TestSyncAssociations(t *testing.T) {
+	logs := make([]string, 0)
+	recordLog := func(ctx ModelContext, operatorType, operatorTypeName string, oldData, newData any) error {
+		logs = append(logs, operatorTypeName)
+		return nil
+	}
+	order, sqls := newDryRunOrder(t, WithRecordLog[testOrder](recordLog))
+
+	// 新增的子表数据回填外键
+	data := &testOrder{OrderId: "SO1", Details: []*testOrderDetail{{SkuCode: "SKU1"}}}
+	assert.Nil(t, order.syncAssociations(order.Db, data, nil))
+	assert.Equal(t, "SO1", data.Details[0].OrderId)
+	assert.Equal(t, "SELECT * FROM `test_order_detail` WHERE `order_id` = ? AND `test_order_detail`.`deleted_at` IS NULL ORDER BY id asc", (*sqls)[0])
+	assert.True(t, strings.HasPrefix((*sqls)[1], "INSERT INTO `test_order_detail`"))
+	assert.Equal(t, []string{"新增"}, logs)
+
+	// 子表字段为nil时不处理
+	assert.Nil(t, order.syncAssociations(order.Db, &testOrder{OrderId: "SO2"}, nil))
+	assert.Len(t, *sqls, 2)
+
+	// 不属于当前数据的子表数据
+	data = &testOrder{OrderId: "SO3", Details: []*testOrderDetail{{BaseModel: BaseModel[testOrderDetail]{Id: 99}}}}
+	assert.NotNil(t, order.syncAssociations(order.Db, data, nil))
+
+	// 关联字段修改时按旧值查询子表数据
+	*sqls = (*sqls)[:0]
+	data = &testOrder{OrderId: "SO5", Details: []*testOrderDetail{}}
+	assert.Nil(t, order.syncAssociations(order.Db, data, &testOrder{OrderId: "SO4"}))
+	assert.Len(t, *sqls, 1)
+}
+
+func TestUpdateAggregateHasOne(t *testing.T) {
+	db, sqls := newDryRunDb(t)
+	invoice := &testInvoice{}
+	invoice.BaseModel = NewBaseModelWithContext(NewContext(context.Background(), "1", "张三"), db, invoice.TableName(), invoice)
+
+	// 按旧数据更新时一对一关联同样保存
+	old := &testInvoice{Title: "A"}
+	old.Id = 1
+	data := &testInvoice{Title: "B", Address: &testInvoiceAddress{Address: "北京"}}
+	data.Id = 1
+	assert.Nil(t, invoice.updateAggregate(invoice.Db, data, old))
+	assert.Equal(t, uint64(1), data.Address.InvoiceId)
+	assert.True(t, strings.HasPrefix((*sqls)[0], "INSERT INTO `test_invoice_address`"))
+	assert.Contains(t, (*sqls)[0], "ON DUPLICATE KEY UPDATE")
+	assert.True(t, strings.HasPrefix((*sqls)[1], "UPDATE `test_invoice` SET"))
+	assert.Contains(t, (*sqls)[1], "`title`=?")
+}
+
+func TestChangedColumns(t *testing.T) {
+	order, _ := newDryRunOrder(t)
+	modelSchema, err := order.parseSchema()
+	assert.Nil(t, err)
+
+	// 只对比业务字段,忽略更新人信息
+	old := &testOrder{OrderId: "SO1", Status: 0}
+	old.UpdateBy = "1"
+	data := &testOrder{OrderId: "SO1", Status: 1}
+	data.UpdateBy = "2"
+	columns := changedColumns(context.Background(), modelSchema, reflect.ValueOf(old).Elem(), reflect.ValueOf(data).Elem())
+	assert.Equal(t, []string{"status"}, columns)
+}
+
+func TestChangedFields(t *testing.T) {
+	order, _ := newDryRunOrder(t)
+
+	// 未加载数据
+	assert.Nil(t, order.ChangedFields())
+
+	// 对比加载时的快照
+	order.Id, order.OrderId = 1, "SO1"
+	order.takeSnapshot(order)
+	assert.Empty(t, order.ChangedFields())
+	order.Status = 1
+	assert.Equal(t, []string{"status"}, order.ChangedFields())
+}
+
+func TestUpdateFields(t *testing.T) {
+	order, sqls := newDryRunOrder(t)
+	order.Id, order.OrderId, order.Status = 1, "SO1", 1
+
+	// 事务中写入的表
+	txTables := make([]string, 0)
+	_ = order.Db.Callback().Create().After("gorm:create").Register("test:tx", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.ConnPool.(*dryRunTx); ok {
+			txTables = append(txTables, tx.Statement.Table)
+		}
+	})
+
+	// 只更新指定字段和更新人信息
+	order.RaiseEvent("OrderUpdated", map[string]any{"orderId": order.OrderId})
+	_, err := order.UpdateFields("status")
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE `test_order` SET `update_by`=?,`update_by_name`=?,`updated_at`=?,`status`=? WHERE `test_order`.`deleted_at` IS NULL AND `id` = ?", (*sqls)[1])
+
+	// 领域事件和操作日志与更新在同一个事务中写入
+	assert.Equal(t, 1, order.Db.Statement.ConnPool.(*dryRunPool).begins)
+	assert.Equal(t, []string{"outbox", "operation_log"}, txTables)
+
+	// 支持json名,一对多字段单独返回
+	columns, relations, err := order.resolveFields([]string{"orderId", "Status", "details"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"order_id", "status"}, columns)
+	assert.Equal(t, []string{"Details"}, relations)
+
+	// 字段不存在或不允许更新
+	_, _, err = order.resolveFields([]string{"xxx"})
+	assert.NotNil(t, err)
+	_, _, err = order.resolveFields([]string{"createBy"})
+	assert.NotNil(t, err)
+	_, err = order.UpdateFields()
+	assert.NotNil(t, err)
+}
+
+func TestDataScope(t *testing.T) {
+	permission := func(db *gorm.DB) *gorm.DB {
+		return db.Where("create_by = ?", "1")
+	}
+
+	// 按Id查询也应用权限条件
+	order, sqls := newDryRunOrder(t, WithPermissionConditons[testOrder](permission))
+	_, _ = order.GetById(1)
+	_, _ = order.CountByBusinessCode("order_id", "SO1")
+	assert.Equal(t, []string{
+		"SELECT * FROM `test_order` WHERE id = ? AND create_by = ? AND `test_order`.`deleted_at` IS NULL ORDER BY `test_order`.`id` LIMIT ?",
+		"SELECT count(*) FROM `test_order` WHERE order_id = ? AND create_by = ? AND `test_order`.`deleted_at` IS NULL",
+	}, *sqls)
+
+	// 唯一校验不应用权限条件
+	*sqls = (*sqls)[:0]
+	_, _ = order.CheckBusinessCodeExist("order_id", "SO1")
+	assert.NotContains(t, (*sqls)[0], "create_by")
+
+	// 恢复、操作记录、读取旧数据也应用权限条件
+	*sqls = (*sqls)[:0]
+	_ = order.Restore(1)
+	_, _ = order.History(1)
+	_, _ = order.UpdateWithData(&testOrder{BaseModel: BaseModel[testOrder]{Id: 1}})
+	assert.Equal(t, "SELECT * FROM `test_order` WHERE id in (?) AND `test_order`.`deleted_at` is not null AND create_by = ?", (*sqls)[0])
+	assert.Equal(t, "SELECT count(*) FROM `test_order` WHERE `test_order`.`id` = ? AND create_by = ?", (*sqls)[1])
+	assert.Equal(t, "SELECT * FROM `test_order` WHERE id = ? AND create_by = ? AND `test_order`.`deleted_at` IS NULL ORDER BY `test_order`.`id` LIMIT ?", (*sqls)[2])
+
+	// 不应用权限条件
+	order, sqls = newDryRunOrder(t, WithPermissionConditons[testOrder](permission), WithoutPermission[testOrder]())
+	_, _ = order.LoadById(1)
+	assert.Equal(t, []string{
+		"SELECT * FROM `test_order` WHERE id = ? AND `test_order`.`deleted_at` IS NULL ORDER BY `test_order`.`id` LIMIT ?",
+	}, *sqls)
+}
+
+func TestEventExecution(t *testing.T) {
+	order, sqls := newDryRunOrder(t)
+	order.Id = 1
+	events := []fsm.EventDesc{{Src: []string{"0"}, Name: "confirm", Dst: "1"}}
+	_ = order.InitStateMachine("0", events, func(ctx context.Context, e *fsm.Event) {
+		order.Status = 1
+		order.RaiseEvent("OrderConfirmed", map[string]any{"orderId": order.OrderId})
+	})
+
+	// 保存状态、写入领域事件、记录日志在同一个事务中
+	assert.Nil(t, order.EventExecution("0", "confirm", "确认"))
+	assert.Equal(t, 1, order.Db.Statement.ConnPool.(*dryRunPool).begins)
+	assert.Len(t, *sqls, 3)
+	assert.True(t, strings.HasPrefix((*sqls)[0], "UPDATE `test_order`"))
+	assert.True(t, strings.HasPrefix((*sqls)[1], "INSERT INTO `outbox`"))
+	assert.True(t, strings.HasPrefix((*sqls)[2], "INSERT INTO `operation_log`"))
+}
+
+// 记录写入outbox表的消息
+func recordMessages(db *gorm.DB) *[]*outbox.Message {
+	messages := make([]*outbox.Message, 0)
+	_ = db.Callback().Create().After("gorm:create").Register("test:outbox", func(tx *gorm.DB) {
+		if list, ok := tx.Statement.Dest.(*[]*outbox.Message); ok {
+			messages = append(messages, *list...)
+		}
+	})
+	return &messages
+}
+
+func TestFlushEvents(t *testing.T) {
+	order, _ := newDryRunOrder(t, WithRecordLog[testOrder](func(ctx ModelContext, operatorType, operatorTypeName string, oldData, newData any) error {
+		return nil
+	}))
+	messages := recordMessages(order.Db)
+
+	// 聚合Id取写入的数据
+	order.RaiseEvent("OrderUpdated", nil)
+	_, err := order.UpdateWithData(&testOrder{BaseModel: BaseModel[testOrder]{Id: 42}})
+	assert.Nil(t, err)
+	assert.Len(t, *messages, 1)
+	assert.Equal(t, uint64(42), (*messages)[0].AggregateId)
+	assert.Empty(t, order.domainEvents)
+
+	// 数据上记录的事件一起写入
+	*messages = (*messages)[:0]
+	data := &testOrder{BaseModel: BaseModel[testOrder]{Id: 43}}
+	data.RaiseEvent("OrderCreated", nil)
+	_, err = order.UpdateWithData(data)
+	assert.Nil(t, err)
+	assert.Len(t, *messages, 1)
+	assert.Equal(t, uint64(43), (*messages)[0].AggregateId)
+	assert.Empty(t, data.domainEvents)
+
+	// 回滚时保留事件,重试时重新写入
+	*messages = (*messages)[:0]
+	order.RaiseEvent("OrderConfirmed", nil)
+	err = order.Transaction(func(tx *gorm.DB) error {
+		if err := order.FlushEvents(&testOrder{BaseModel: BaseModel[testOrder]{Id: 1}}); err != nil {
+			return err
+		}
+		return errors.New("failed")
+	})
+	assert.NotNil(t, err)
+	assert.Len(t, order.domainEvents, 1)
+	err = order.Transaction(func(tx *gorm.DB) error {
+		return order.FlushEvents(&testOrder{BaseModel: BaseModel[testOrder]{Id: 1}})
+	})
+	assert.Nil(t, err)
+	assert.Len(t, *messages, 2)
+	assert.Empty(t, order.domainEvents)
+}
+
+func TestCreateBatchEvents(t *testing.T) {
+	order, _ := newDryRunOrder(t, WithRecordLog[testOrder](func(ctx ModelContext, operatorType, operatorTypeName string, oldData, newData any) error {
+		return nil
+	}))
+	messages := recordMessages(order.Db)
+
+	// 每条数据的事件按该数据的Id写入
+	items := []*testOrder{{BaseModel: BaseModel[testOrder]{Id: 7}}, {BaseModel: BaseModel[testOrder]{Id: 8}}}
+	items[0].RaiseEvent("OrderCreated", nil)
+	items[1].RaiseEvent("OrderCreated", nil)
+	result, err := order.CreateBatch(items, 10)
+	assert.Nil(t, err)
+	assert.Nil(t, result.Err())
+	assert.Len(t, *messages, 2)
+	assert.Equal(t, uint64(7), (*messages)[0].AggregateId)
+	assert.Equal(t, uint64(8), (*messages)[1].AggregateId)
+}
+
+func TestOperatorWithoutUser(t *testing.T) {
+	db, sqls := newDryRunDb(t)
+	ctx := &valueContext{Context: context.Background(), keys: make(map[string]any)}
+	order := &testOrder{}
+	order.BaseModel = NewBaseModelWithContext(ctx, db, order.TableName(), order)
+
+	// 没有用户时操作人为空,不记录操作日志
+	assert.Equal(t, "", order.OperatorId)
+	assert.Equal(t, "", order.OperatorName)
+	assert.NotNil(t, order.RecordLog(LogTypeCreate, "新增", nil, order))
+	assert.Empty(t, *sqls)
+}
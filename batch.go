@@ -0,0 +1,132 @@
+package base
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 批量处理单条数据结果
+type BatchItemResult struct {
+	Index int    // 数据在入参中的下标
+	Id    uint64 // 数据Id
+	Err   error  // 失败原因 | 成功为nil
+}
+
+// 批量处理结果
+type BatchResult struct {
+	Success int                // 成功条数
+	Failed  int                // 失败条数
+	Items   []*BatchItemResult // 每条数据的处理结果 | 与入参顺序一致
+}
+
+// 失败的数据
+func (r *BatchResult) FailedItems() []*BatchItemResult {
+	items := make([]*BatchItemResult, 0, r.Failed)
+	for _, item := range r.Items {
+		if item.Err != nil {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// 汇总错误 | 全部成功返回nil
+func (r *BatchResult) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, r.Failed)
+	for _, item := range r.FailedItems() {
+		msgs = append(msgs, fmt.Sprintf("第%d条:%s", item.Index+1, item.Err.Error()))
+	}
+	return fmt.Errorf("批量处理失败%d条[%s]", r.Failed, strings.Join(msgs, ";"))
+}
+
+// 批量新增 | 按chunkSize分批插入,关联的子表数据一起插入,每条数据记录一条操作日志
+//
+// 每条数据上RaiseEvent记录的领域事件按该数据的Id写入outbox表
+//
+// 每批在独立的事务(已有事务时为保存点)中执行;某批失败时回滚该批,再逐条重试,得到每条数据的结果
+func (b *BaseModel[T]) CreateBatch(items []*T, chunkSize int) (*BatchResult, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("[%s]批量新增的批次大小必须大于0,请开发检查", b.TableName)
+	}
+
+	result := &BatchResult{Items: make([]*BatchItemResult, len(items))}
+	for start := 0; start < len(items); start += chunkSize {
+		end := start + chunkSize
+		if end > len(items) {
+			end = len(items)
+		}
+		chunk := items[start:end]
+
+		// 整批插入
+		err := b.TransactionWithPropagation(PropagationNested, func(tx *gorm.DB) error {
+			return b.createChunk(tx, chunk)
+		})
+		if err == nil {
+			for i, item := range chunk {
+				result.Items[start+i] = &BatchItemResult{Index: start + i, Id: entityId(item)}
+			}
+			result.Success += len(chunk)
+			continue
+		}
+
+		// 整批失败 | 重置Id后逐条重试
+		for i, item := range chunk {
+			resetIds(reflect.ValueOf(item))
+			err := b.TransactionWithPropagation(PropagationNested, func(tx *gorm.DB) error {
+				return b.createChunk(tx, []*T{item})
+			})
+			if err != nil {
+				resetIds(reflect.ValueOf(item))
+				result.Items[start+i] = &BatchItemResult{Index: start + i, Err: err}
+				result.Failed++
+				continue
+			}
+			result.Items[start+i] = &BatchItemResult{Index: start + i, Id: entityId(item)}
+			result.Success++
+		}
+	}
+	return result, nil
+}
+
+// 插入一批数据,写入每条数据的领域事件并记录操作日志 | 与Create一样按聚合新增,子表数据回填外键并记录操作日志
+func (b *BaseModel[T]) createChunk(tx *gorm.DB, chunk []*T) error {
+	if err := b.createAggregate(tx, chunk...); err != nil {
+		return err
+	}
+	for _, item := range chunk {
+		if err := b.writeEvents(modelOf(item), entityId(item)); err != nil {
+			return err
+		}
+		if err := b.RecordLog(LogTypeCreate, "新增", new(T), item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 重置数据和子表数据的Id | 插入失败回滚后Id已被赋值,重试前需要清空
+func resetIds(val reflect.Value) {
+	val = indirectValue(val)
+	if !val.IsValid() || val.Kind() != reflect.Struct {
+		return
+	}
+	if field := val.FieldByName("Id"); field.IsValid() && field.CanSet() {
+		field.Set(reflect.Zero(field.Type()))
+	}
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		if !field.IsExported() || field.Anonymous || strings.HasPrefix(field.Tag.Get("gorm"), "-") || !isStructSlice(field.Type) {
+			continue
+		}
+		children := val.Field(i)
+		for j := 0; j < children.Len(); j++ {
+			resetIds(children.Index(j))
+		}
+	}
+}
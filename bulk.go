@@ -0,0 +1,120 @@
+package base
+
+import (
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// 批量操作日志内容 | 每条数据记录一条
+type bulkChange struct {
+	Id      uint64         `json:"id"`                // 数据Id
+	Changes map[string]any `json:"changes,omitempty"` // 修改的字段
+}
+
+// 按条件批量更新 | 返回影响的条数
+//
+// 与List一样应用默认条件和权限条件,changes的key为表字段名;
+// 主键、创建信息、删除标记和版本号不允许修改,没有编辑权限的字段不允许修改,每条数据记录一条操作日志
+func (b *BaseModel[T]) UpdateWhere(cond SearchCondition, changes map[string]any) (int64, error) {
+	if len(changes) == 0 {
+		return 0, fmt.Errorf("[%s]批量更新的字段不能为空,请开发检查", b.TableName)
+	}
+	versionField, err := b.versionField()
+	if err != nil {
+		return 0, err
+	}
+	columns := make([]string, 0, len(changes))
+	for column := range changes {
+		columns = append(columns, column)
+		if err := validateSafeColumnName(column); err != nil {
+			return 0, err
+		}
+		denied := column == "id" || column == "deleted_at" || column == "deleted_by" || slices.Contains(OmitCreateFileds, column)
+		if denied || versionField != nil && column == versionField.DBName {
+			return 0, fmt.Errorf("[%s]字段[%s]不允许批量更新,请开发检查", b.TableName, column)
+		}
+	}
+	if err := b.checkEditableColumns(columns); err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	err = b.Transaction(func(tx *gorm.DB) error {
+		// 1. 查询符合条件的数据Id
+		ids, err := b.idsWhere(tx, cond)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		// 2. 更新数据 | 维护更新人信息,开启乐观锁时递增版本号
+		updates := make(map[string]any, len(changes)+4)
+		for column, value := range changes {
+			updates[column] = value
+		}
+		updates["update_by"] = b.OperatorId
+		updates["update_by_name"] = b.OperatorName
+		updates["updated_at"] = b.CurrTime()
+		if versionField != nil {
+			updates[versionField.DBName] = gorm.Expr(fmt.Sprintf("`%s` + 1", versionField.DBName))
+		}
+		res := tx.Model(new(T)).Where("id in ?", ids).UpdateColumns(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		affected = res.RowsAffected
+
+		// 3. 记录日志
+		for _, id := range ids {
+			if err := b.RecordLog(LogTypeUpdate, "批量更新", nil, &bulkChange{Id: id, Changes: changes}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
+// 按条件批量删除 | 返回影响的条数
+//
+// 与List一样应用默认条件和权限条件;与Del一样执行删除校验并按onDelete标记处理子表数据,每条数据记录一条操作日志
+func (b *BaseModel[T]) DeleteWhere(cond SearchCondition) (int64, error) {
+	var affected int64
+	err := b.Transaction(func(tx *gorm.DB) error {
+		// 1. 查询符合条件的数据 | 预加载一对多子表
+		db, err := b.preloadHasMany(tx.
+			Scopes(b.dataScope). // 数据范围
+			Scopes(cond).        // 搜索条件
+			Scopes(b.ClearOffset()))
+		if err != nil {
+			return err
+		}
+		list := make([]*T, 0)
+		if err := db.Find(&list).Error; err != nil || len(list) == 0 {
+			return err
+		}
+
+		// 2. 删除数据
+		affected, err = b.deleteEntities(tx, list, "批量删除")
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
+// 查询符合条件的数据Id | 应用默认条件和权限条件,忽略分页
+func (b *BaseModel[T]) idsWhere(tx *gorm.DB, cond SearchCondition) ([]uint64, error) {
+	ids := make([]uint64, 0)
+	err := tx.Model(new(T)).
+		Scopes(b.dataScope). // 数据范围
+		Scopes(cond).        // 搜索条件
+		Scopes(b.ClearOffset()).
+		Pluck(fmt.Sprintf("`%s`.`id`", b.TableName), &ids).Error
+	return ids, err
+}
@@ -0,0 +1,58 @@
+package base
+
+import (
+	"context"
+	"sync"
+)
+
+// 模型上下文 | 携带用户身份、截止时间和事务状态
+//
+// *gin.Context 天然实现该接口; MQ消费、定时任务、命令行工具等非HTTP场景使用 NewContext 构造
+type ModelContext interface {
+	context.Context
+	Get(key string) (value any, exists bool) // 读取上下文数据
+	Set(key string, value any)               // 写入上下文数据
+}
+
+// 上下文实现 | 键值存放在本地map中,读取不到时回退到父context
+type valueContext struct {
+	context.Context
+	mu   sync.RWMutex
+	keys map[string]any
+}
+
+// 实例化模型上下文 | parent提供截止时间和取消信号,userId和userName作为当前操作人
+func NewContext(parent context.Context, userId, userName string) ModelContext {
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx := &valueContext{Context: parent, keys: make(map[string]any)}
+	ctx.Set("currUserId", userId)
+	ctx.Set("currUserName", userName)
+	return ctx
+}
+
+// 读取上下文数据
+func (c *valueContext) Get(key string) (value any, exists bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, exists = c.keys[key]
+	return
+}
+
+// 写入上下文数据
+func (c *valueContext) Set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[key] = value
+}
+
+// 实现context.Context | 优先读取本地数据
+func (c *valueContext) Value(key any) any {
+	if keyAsString, ok := key.(string); ok {
+		if value, exists := c.Get(keyAsString); exists {
+			return value
+		}
+	}
+	return c.Context.Value(key)
+}
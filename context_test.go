@@ -0,0 +1,35 @@
+package base
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKey string
+
+func TestNewContext(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey("traceId"), "T1"), time.Minute)
+	defer cancel()
+
+	ctx := NewContext(parent, "1", "张三")
+
+	// 用户信息
+	userId, ok := ctx.Get("currUserId")
+	assert.True(t, ok)
+	assert.Equal(t, "1", userId)
+	assert.Equal(t, "张三", ctx.Value("currUserName"))
+
+	// 读写数据
+	ctx.Set("CurrTime", "2025-01-01")
+	assert.Equal(t, "2025-01-01", ctx.Value("CurrTime"))
+
+	// 继承父context
+	assert.Equal(t, "T1", ctx.Value(ctxKey("traceId")))
+	_, ok = ctx.Deadline()
+	assert.True(t, ok)
+	cancel()
+	assert.NotNil(t, ctx.Err())
+}
@@ -0,0 +1,239 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 游标无效
+var ErrInvalidCursor = errors.New("分页游标无效,请重新查询")
+
+// 分页限制 | 0表示不限制
+var (
+	MaxPageSize int64 = 0 // 每页最大数量 | pageSize超过或为-1时按该值查询
+	MaxOffset   int64 = 0 // 最大偏移量 | 超过时报错,深分页请使用游标分页
+)
+
+// 解析数据结构缓存
+var schemaCache = &sync.Map{}
+
+// 排序键
+type sortKey struct {
+	Table  string // 表名 | e.g. sales_order
+	Column string // 字段名 | e.g. created_at
+	Desc   bool   // 是否倒序
+}
+
+// 排序条件格式 | `table`.`column` asc|desc
+var sortKeyPattern = regexp.MustCompile("(?i)^`(\\w+)`\\.`(\\w+)` (asc|desc)$")
+
+// 游标中的值
+type cursorValue struct {
+	Type  string `json:"t,omitempty"` // 值类型 | time: 时间
+	Value any    `json:"v"`           // 值
+}
+
+// 解析排序条件 | 只接受 `table`.`column` asc|desc,其他格式报错
+func parseSortKeys(orders []string) ([]sortKey, error) {
+	keys := make([]sortKey, 0, len(orders))
+	for _, order := range orders {
+		matches := sortKeyPattern.FindStringSubmatch(order)
+		if matches == nil {
+			return nil, fmt.Errorf("游标分页的排序条件[%s]无效,请检查排序条件", order)
+		}
+		keys = append(keys, sortKey{
+			Table:  matches[1],
+			Column: matches[2],
+			Desc:   strings.EqualFold(matches[3], "desc"),
+		})
+	}
+	return keys, nil
+}
+
+// 游标分页 | 按排序键和id排序,从游标位置向后读取pageSize条
+//
+// 所有排序键方向必须一致,未指定排序时按id倒序
+func (e *GormCondition) applyCursor(db *gorm.DB) *gorm.DB {
+	keys, err := parseSortKeys(e.Order)
+	if err != nil {
+		_ = db.AddError(err)
+		return db
+	}
+	desc := true
+	if len(keys) > 0 {
+		desc = keys[0].Desc
+	}
+	for _, key := range keys {
+		if key.Desc != desc {
+			_ = db.AddError(fmt.Errorf("游标分页的排序方向必须一致,请检查排序条件"))
+			return db
+		}
+	}
+
+	// 排序 | id作为最后的排序键保证顺序唯一
+	idColumn := clause.Column{Table: clause.CurrentTable, Name: "id"}
+	for _, key := range keys {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Table: key.Table, Name: key.Column}, Desc: key.Desc})
+	}
+	db = db.Order(clause.OrderByColumn{Column: idColumn, Desc: desc})
+
+	// 从游标位置开始 | (col, id) < (?, ?)
+	if e.Cursor != "" {
+		values, err := decodeCursor(e.Cursor)
+		if err != nil || len(values) != len(keys)+1 {
+			_ = db.AddError(ErrInvalidCursor)
+			return db
+		}
+		columns := make([]any, 0, len(values))
+		for _, key := range keys {
+			columns = append(columns, clause.Column{Table: key.Table, Name: key.Column})
+		}
+		columns = append(columns, idColumn)
+
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		sql := fmt.Sprintf("(%s) %s (%s)", placeholders, op, placeholders)
+		db = db.Where(sql, append(columns, values...)...)
+	}
+
+	// 每页数量
+	_, pageSize := e.resolvePage()
+	return db.Offset(-1).Limit(int(pageSize))
+}
+
+// 是否为游标分页 | 查询条件中有search:"cursor"标签的字段
+func IsCursorMode(q interface{}) bool {
+	condition := &GormCondition{
+		GormPublic: GormPublic{},
+		Join:       make([]*GormJoin, 0),
+	}
+	ResolveSearchQuery(Driver, q, condition)
+	return condition.CursorMode
+}
+
+// 游标分页的排序字段 | 格式: table.column,不包含最后追加的id
+func CursorSortColumns(q interface{}) ([]string, error) {
+	condition := &GormCondition{
+		GormPublic: GormPublic{},
+		Join:       make([]*GormJoin, 0),
+	}
+	ResolveSearchQuery(Driver, q, condition)
+	keys, err := parseSortKeys(condition.Order)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, 0, len(keys))
+	for _, key := range keys {
+		columns = append(columns, key.Table+"."+key.Column)
+	}
+	return columns, nil
+}
+
+// 生成下一页游标 | q为本次查询条件,last为本页最后一条数据
+func NextCursor(q interface{}, last any) (string, error) {
+	if last == nil || (reflect.ValueOf(last).Kind() == reflect.Ptr && reflect.ValueOf(last).IsNil()) {
+		return "", nil
+	}
+	condition := &GormCondition{
+		GormPublic: GormPublic{},
+		Join:       make([]*GormJoin, 0),
+	}
+	ResolveSearchQuery(Driver, q, condition)
+
+	// 解析数据结构
+	lastSchema, err := schema.Parse(last, schemaCache, schema.NamingStrategy{SingularTable: true})
+	if err != nil {
+		return "", err
+	}
+	reflectValue := reflect.Indirect(reflect.ValueOf(last))
+
+	// 按排序键读取值 | 最后追加id
+	keys, err := parseSortKeys(condition.Order)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		names = append(names, key.Column)
+	}
+	names = append(names, "id")
+	values := make([]any, 0, len(names))
+	for _, name := range names {
+		field := lastSchema.LookUpField(name)
+		if field == nil {
+			return "", fmt.Errorf("游标字段[%s]不存在,请开发检查", name)
+		}
+		value, _ := field.ValueOf(context.Background(), reflectValue)
+		values = append(values, value)
+	}
+	return encodeCursor(values)
+}
+
+// 编码游标
+func encodeCursor(values []any) (string, error) {
+	list := make([]cursorValue, 0, len(values))
+	for _, value := range values {
+		if valuer, ok := value.(driver.Valuer); ok {
+			v, err := valuer.Value()
+			if err != nil {
+				return "", err
+			}
+			value = v
+		}
+		if t, ok := value.(time.Time); ok {
+			list = append(list, cursorValue{Type: "time", Value: t.Format(time.RFC3339Nano)})
+			continue
+		}
+		list = append(list, cursorValue{Value: value})
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// 解码游标
+func decodeCursor(cursor string) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]cursorValue, 0)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&list); err != nil {
+		return nil, err
+	}
+	values := make([]any, 0, len(list))
+	for _, item := range list {
+		if item.Type == "time" {
+			str, _ := item.Value.(string)
+			t, err := time.Parse(time.RFC3339Nano, str)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, t)
+			continue
+		}
+		values = append(values, item.Value)
+	}
+	return values, nil
+}
@@ -16,13 +16,16 @@ type Condition interface {
 	SetJoinOn(t, on string) Condition
 	SetPage(k string)
 	SetPageSize(k string)
+	SetCursor(k string)
 }
 
 type GormCondition struct {
 	GormPublic
-	Join     []*GormJoin
-	Page     string
-	PageSize string
+	Join       []*GormJoin
+	Page       string
+	PageSize   string
+	Cursor     string
+	CursorMode bool
 }
 
 type GormPublic struct {
@@ -44,6 +47,8 @@ func (e *GormJoin) SetPage(k string) {
 }
 func (e *GormJoin) SetPageSize(k string) {
 }
+func (e *GormJoin) SetCursor(k string) {
+}
 
 func (e *GormPublic) SetWhere(k string, v []interface{}) {
 	if e.Where == nil {
@@ -99,6 +104,11 @@ func (e *GormCondition) SetPageSize(k string) {
 	e.PageSize = k
 }
 
+func (e *GormCondition) SetCursor(k string) {
+	e.CursorMode = true
+	e.Cursor = k
+}
+
 type resolveSearchTag struct {
 	Type   string   // 条件类型
 	Column string   // 表字段
@@ -142,6 +152,8 @@ func makeTag(tag string) *resolveSearchTag {
 			r.Type = "page"
 		case "pageSize":
 			r.Type = "pageSize"
+		case "cursor":
+			r.Type = "cursor"
 		}
 	}
 	return r
@@ -192,6 +204,12 @@ func ResolveSearchQuery(driver string, q interface{}, condition Condition) {
 		}
 		t = makeTag(tag)
 
+		// 游标为空时表示游标分页的第一页
+		if t.Type == "cursor" {
+			condition.SetCursor(qValue.Field(i).String())
+			continue
+		}
+
 		// 跳过空值
 		if qValue.Field(i).IsZero() {
 			continue
@@ -290,6 +308,7 @@ var (
 // in
 // isnull / 0或false >> is null  1或true >> is not null
 // order 排序		e.g. order[key]=desc     order[key]=asc
+// cursor 游标分页 | 按排序键和id定位,不使用offset
 func MakeCondition(q interface{}) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		condition := &GormCondition{
@@ -318,27 +337,27 @@ func MakeCondition(q interface{}) func(db *gorm.DB) *gorm.DB {
 		for k, v := range condition.Or {
 			db = db.Or(k, v...)
 		}
+		// 游标分页
+		if condition.CursorMode {
+			return condition.applyCursor(db)
+		}
 		for _, o := range condition.Order {
 			db = db.Order(o)
 		}
 		if condition.Page != "" && condition.PageSize != "" {
 			// 查询全部
-			if condition.PageSize == "-1" {
+			page, pageSize := condition.resolvePage()
+			if pageSize == -1 {
 				db = db.Offset(0).Limit(-1)
 			} else {
-				page, _ := strconv.Atoi(condition.Page)
-				pageSize, _ := strconv.Atoi(condition.PageSize)
-				if page <= 0 {
-					page = 1
-				}
-				if pageSize <= 0 {
-					pageSize = 10
-				}
-
 				offset := (page - 1) * pageSize
 				if offset < 0 {
 					offset = 0
 				}
+				if MaxOffset > 0 && offset > MaxOffset {
+					_ = db.AddError(fmt.Errorf("分页偏移量[%d]超过上限[%d],请使用游标分页", offset, MaxOffset))
+					return db
+				}
 				db = db.Offset(int(offset)).Limit(int(pageSize))
 			}
 		}
@@ -346,6 +365,49 @@ func MakeCondition(q interface{}) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
+// 解析分页参数 | 未传分页参数时返回0,0; pageSize为-1表示查询全部; 游标分页时page为0
+func ResolvePage(q interface{}) (page, pageSize int64) {
+	condition := &GormCondition{
+		GormPublic: GormPublic{},
+		Join:       make([]*GormJoin, 0),
+	}
+	ResolveSearchQuery(Driver, q, condition)
+	return condition.resolvePage()
+}
+
+// 解析分页参数 | 页码默认1
+func (e *GormCondition) resolvePage() (page, pageSize int64) {
+	pageSize, _ = strconv.ParseInt(e.PageSize, 10, 64)
+	if e.CursorMode {
+		return 0, limitPageSize(pageSize)
+	}
+	if e.Page == "" || e.PageSize == "" {
+		return 0, 0
+	}
+	page, _ = strconv.ParseInt(e.Page, 10, 64)
+	if page <= 0 {
+		page = 1
+	}
+	return page, limitPageSize(pageSize)
+}
+
+// 每页数量 | 默认10,-1表示查询全部,不超过MaxPageSize
+func limitPageSize(pageSize int64) int64 {
+	if pageSize == -1 {
+		if MaxPageSize > 0 {
+			return MaxPageSize
+		}
+		return -1
+	}
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	if MaxPageSize > 0 && pageSize > MaxPageSize {
+		return MaxPageSize
+	}
+	return pageSize
+}
+
 // 生成分页scope | 废弃，以融合到上面一个函数里
 func Paginate(page, pageSize int64) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type pageSearch struct {
+	Page     int64  `search:"page"`
+	PageSize int64  `search:"pageSize"`
+	Name     string `search:"type:eq;column:name;table:user"`
+}
+
+func TestResolvePage(t *testing.T) {
+	tests := []struct {
+		name         string
+		search       pageSearch
+		wantPage     int64
+		wantPageSize int64
+	}{
+		{
+			name:         "Normal",
+			search:       pageSearch{Page: 2, PageSize: 20},
+			wantPage:     2,
+			wantPageSize: 20,
+		},
+		{
+			name:         "All",
+			search:       pageSearch{Page: 1, PageSize: -1},
+			wantPage:     1,
+			wantPageSize: -1,
+		},
+		{
+			name:         "Negative page",
+			search:       pageSearch{Page: -1, PageSize: 5},
+			wantPage:     1,
+			wantPageSize: 5,
+		},
+		{
+			name:         "No page",
+			search:       pageSearch{Name: "张三"},
+			wantPage:     0,
+			wantPageSize: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, pageSize := ResolvePage(tt.search)
+			if page != tt.wantPage || pageSize != tt.wantPageSize {
+				t.Errorf("ResolvePage() = %d,%d, want %d,%d", page, pageSize, tt.wantPage, tt.wantPageSize)
+			}
+		})
+	}
+}
+
+type cursorUser struct {
+	Id        uint64
+	Name      string
+	CreatedAt LocalTime
+}
+
+type cursorSearch struct {
+	Cursor        string `search:"cursor"`
+	PageSize      int64  `search:"pageSize"`
+	CreatedAtSort string `search:"type:order;column:created_at;table:cursor_user"`
+	NameSort      string `search:"type:order;column:name;table:cursor_user"`
+}
+
+func dryRunDb(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{SkipInitializeWithVersion: true}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		NamingStrategy:       schema.NamingStrategy{SingularTable: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCursorPage(t *testing.T) {
+	db := dryRunDb(t)
+
+	// 第一页
+	search := cursorSearch{PageSize: 20, CreatedAtSort: "desc"}
+	stmt := db.Model(&cursorUser{}).Scopes(MakeCondition(search)).Find(&[]*cursorUser{}).Statement
+	wantSQL := "SELECT * FROM `cursor_user` ORDER BY `cursor_user`.`created_at` DESC,`cursor_user`.`id` DESC LIMIT ?"
+	if got := stmt.SQL.String(); got != wantSQL {
+		t.Errorf("first page SQL = %s, want %s", got, wantSQL)
+	}
+
+	// 下一页
+	last := &cursorUser{Id: 8, CreatedAt: LocalTime(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))}
+	cursor, err := NextCursor(search, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search.Cursor = cursor
+	stmt = db.Model(&cursorUser{}).Scopes(MakeCondition(search)).Find(&[]*cursorUser{}).Statement
+	wantSQL = "SELECT * FROM `cursor_user` WHERE (`cursor_user`.`created_at`, `cursor_user`.`id`) < (?, ?) ORDER BY `cursor_user`.`created_at` DESC,`cursor_user`.`id` DESC LIMIT ?"
+	if got := stmt.SQL.String(); got != wantSQL {
+		t.Errorf("next page SQL = %s, want %s", got, wantSQL)
+	}
+	if len(stmt.Vars) != 3 || !stmt.Vars[0].(time.Time).Equal(time.Time(last.CreatedAt)) || fmt.Sprint(stmt.Vars[1]) != "8" {
+		t.Errorf("next page vars = %v", stmt.Vars)
+	}
+
+	// 排序方向不一致
+	search = cursorSearch{CreatedAtSort: "desc", NameSort: "asc"}
+	if err := db.Model(&cursorUser{}).Scopes(MakeCondition(search)).Find(&[]*cursorUser{}).Error; err == nil {
+		t.Errorf("mixed sort directions should fail")
+	}
+
+	// 游标无效
+	search = cursorSearch{Cursor: "invalid"}
+	if err := db.Model(&cursorUser{}).Scopes(MakeCondition(search)).Find(&[]*cursorUser{}).Error; !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("invalid cursor error = %v", err)
+	}
+}
+
+func TestParseSortKeys(t *testing.T) {
+	keys, err := parseSortKeys([]string{"`cursor_user`.`created_at` DESC"})
+	if err != nil || len(keys) != 1 || keys[0] != (sortKey{Table: "cursor_user", Column: "created_at", Desc: true}) {
+		t.Errorf("keys = %v, err = %v", keys, err)
+	}
+
+	// 注入的排序条件
+	for _, order := range []string{
+		"`cursor_user`.`name` desc, (select 1) desc",
+		"(select 1) desc",
+		"`cursor_user`.`name` sleep(1)",
+		"`cursor_user`.`name`",
+	} {
+		if _, err := parseSortKeys([]string{order}); err == nil {
+			t.Errorf("order %q should fail", order)
+		}
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	db := dryRunDb(t)
+	MaxPageSize, MaxOffset = 100, 1000
+	defer func() { MaxPageSize, MaxOffset = 0, 0 }()
+
+	// 查询全部按最大数量查询
+	_, pageSize := ResolvePage(pageSearch{Page: 1, PageSize: -1})
+	if pageSize != 100 {
+		t.Errorf("pageSize = %d, want 100", pageSize)
+	}
+
+	// 深分页报错
+	err := db.Model(&cursorUser{}).Scopes(MakeCondition(pageSearch{Page: 20, PageSize: 100})).Find(&[]*cursorUser{}).Error
+	if err == nil {
+		t.Errorf("deep offset should fail")
+	}
+}
@@ -0,0 +1,279 @@
+package base
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// 字段变更
+type FieldChange struct {
+	Field string `json:"field"` // 字段路径 | 子表按Id定位,未保存的子表数据按下标定位 e.g. SalesOrderDetails[1].SkuCode, SalesOrderDetails[new#0]
+	Label string `json:"label"` // 字段名称 | 取comment标签
+	Old   string `json:"old"`   // 旧值
+	New   string `json:"new"`   // 新值
+}
+
+// 变更描述 | e.g. 收货地址: 北京市朝阳区 → 北京市朝阳区2
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s: %s → %s", c.Label, c.Old, c.New)
+}
+
+// 对比新旧数据
+//
+// 只对比带comment标签的字段,comment作为字段名称;
+// 一对多子表(结构体切片)按Id匹配,分别记录新增,删除和字段变更;字段路径统一按Id定位,未保存的数据为[new#下标]
+func DiffData(oldData, newData any) []FieldChange {
+	oldVal := indirectValue(reflect.ValueOf(oldData))
+	newVal := indirectValue(reflect.ValueOf(newData))
+	if !oldVal.IsValid() && !newVal.IsValid() {
+		return nil
+	}
+	if oldVal.IsValid() && newVal.IsValid() && oldVal.Type() != newVal.Type() {
+		return nil
+	}
+	return diffStruct("", "", oldVal, newVal)
+}
+
+// 对比结构体字段
+func diffStruct(path, labelPrefix string, oldVal, newVal reflect.Value) []FieldChange {
+	structType := validType(oldVal, newVal)
+	if structType == nil || structType.Kind() != reflect.Struct {
+		return nil
+	}
+
+	changes := make([]FieldChange, 0)
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		oldField, newField := structField(oldVal, i), structField(newVal, i)
+
+		// 匿名嵌套结构体 | 例如BaseModel
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			changes = append(changes, diffStruct(path, labelPrefix, oldField, newField)...)
+			continue
+		}
+
+		label := field.Tag.Get("comment")
+		if label == "" {
+			continue
+		}
+		fieldPath := path + field.Name
+		fieldLabel := labelPrefix + label
+
+		// 一对多子表
+		if isStructSlice(field.Type) {
+			changes = append(changes, diffChildren(fieldPath, fieldLabel, oldField, newField)...)
+			continue
+		}
+
+		// 普通字段
+		oldStr, newStr := formatValue(oldField), formatValue(newField)
+		if oldStr != newStr {
+			changes = append(changes, FieldChange{Field: fieldPath, Label: fieldLabel, Old: oldStr, New: newStr})
+		}
+	}
+	return changes
+}
+
+// 对比一对多子表 | 按Id匹配
+func diffChildren(path, label string, oldList, newList reflect.Value) []FieldChange {
+	changes := make([]FieldChange, 0)
+
+	// 旧数据按Id索引
+	oldMap := make(map[uint64]reflect.Value)
+	oldIds := make([]uint64, 0)
+	if oldList.IsValid() {
+		for i := 0; i < oldList.Len(); i++ {
+			item := indirectValue(oldList.Index(i))
+			if id := entityIdOf(item); id != 0 {
+				oldMap[id] = item
+				oldIds = append(oldIds, id)
+			}
+		}
+	}
+
+	// 新增和变更
+	matched := make(map[uint64]struct{})
+	if newList.IsValid() {
+		for i := 0; i < newList.Len(); i++ {
+			item := indirectValue(newList.Index(i))
+			if !item.IsValid() {
+				continue
+			}
+			id := entityIdOf(item)
+			oldItem, exist := oldMap[id]
+			if id == 0 || !exist {
+				itemPath := fmt.Sprintf("%s[%d]", path, id)
+				if id == 0 {
+					itemPath = fmt.Sprintf("%s[new#%d]", path, i)
+				}
+				changes = append(changes, FieldChange{
+					Field: itemPath,
+					Label: label,
+					Old:   "",
+					New:   "新增(" + summaryValue(item) + ")",
+				})
+				continue
+			}
+			matched[id] = struct{}{}
+			itemPath := fmt.Sprintf("%s[%d].", path, id)
+			itemLabel := fmt.Sprintf("%s[%d].", label, id)
+			changes = append(changes, diffStruct(itemPath, itemLabel, oldItem, item)...)
+		}
+	}
+
+	// 删除
+	for _, id := range oldIds {
+		if _, ok := matched[id]; ok {
+			continue
+		}
+		changes = append(changes, FieldChange{
+			Field: fmt.Sprintf("%s[%d]", path, id),
+			Label: label,
+			Old:   "删除(" + summaryValue(oldMap[id]) + ")",
+			New:   "",
+		})
+	}
+	return changes
+}
+
+// 结构体摘要 | 带comment标签的非空字段
+func summaryValue(val reflect.Value) string {
+	if !val.IsValid() || val.Kind() != reflect.Struct {
+		return ""
+	}
+	items := make([]string, 0)
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		label := field.Tag.Get("comment")
+		if !field.IsExported() || label == "" || isStructSlice(field.Type) {
+			continue
+		}
+		if str := formatValue(val.Field(i)); str != "" {
+			items = append(items, label+":"+str)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// 格式化字段值 | 优先使用String()
+func formatValue(val reflect.Value) string {
+	val = indirectValue(val)
+	if !val.IsValid() {
+		return ""
+	}
+	ptr := reflect.New(val.Type())
+	ptr.Elem().Set(val)
+	if stringer, ok := ptr.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%v", val.Interface())
+}
+
+// 读取Id字段
+func entityIdOf(val reflect.Value) uint64 {
+	if !val.IsValid() || val.Kind() != reflect.Struct {
+		return 0
+	}
+	field := val.FieldByName("Id")
+	if !field.IsValid() {
+		return 0
+	}
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field.Uint()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(field.Int())
+	}
+	return 0
+}
+
+// 解引用 | nil指针返回无效值
+func indirectValue(val reflect.Value) reflect.Value {
+	for val.IsValid() && (val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) {
+		if val.IsNil() {
+			return reflect.Value{}
+		}
+		val = val.Elem()
+	}
+	return val
+}
+
+// 读取结构体字段 | 结构体无效时返回无效值
+func structField(val reflect.Value, i int) reflect.Value {
+	if !val.IsValid() {
+		return reflect.Value{}
+	}
+	return val.Field(i)
+}
+
+// 取有效值的类型
+func validType(vals ...reflect.Value) reflect.Type {
+	for _, val := range vals {
+		if val.IsValid() {
+			return val.Type()
+		}
+	}
+	return nil
+}
+
+// 是否为结构体切片 | []T 或 []*T
+func isStructSlice(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice {
+		return false
+	}
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Struct
+}
+
+// 深拷贝数据 | 跳过gorm:"-"的字段(数据库连接,上下文,状态机等),这些字段保持浅拷贝
+func cloneValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		newVal := reflect.New(src.Type().Elem())
+		cloneValue(newVal.Elem(), src.Elem())
+		dst.Set(newVal)
+	case reflect.Struct:
+		dst.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			field := src.Type().Field(i)
+			if !field.IsExported() || strings.HasPrefix(field.Tag.Get("gorm"), "-") {
+				continue
+			}
+			switch field.Type.Kind() {
+			case reflect.Ptr, reflect.Struct, reflect.Slice, reflect.Map:
+				cloneValue(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		newVal := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			cloneValue(newVal.Index(i), src.Index(i))
+		}
+		dst.Set(newVal)
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		newVal := reflect.MakeMapWithSize(src.Type(), src.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			newVal.SetMapIndex(iter.Key(), iter.Value())
+		}
+		dst.Set(newVal)
+	default:
+		dst.Set(src)
+	}
+}
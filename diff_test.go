@@ -0,0 +1,66 @@
+package base
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type diffDetail struct {
+	Id       uint64  `json:"id"`
+	SkuCode  string  `json:"skuCode" comment:"SKU编码"`
+	Quantity float64 `json:"quantity" comment:"订单数量"`
+}
+
+type diffOrder struct {
+	Id      uint64        `json:"id"`
+	Remark  string        `json:"remark"`
+	Address string        `json:"address" comment:"收货地址"`
+	Details []*diffDetail `json:"details" comment:"销售单明细"`
+}
+
+func TestDiffData(t *testing.T) {
+	oldData := &diffOrder{
+		Id:      1,
+		Remark:  "无comment不对比",
+		Address: "北京市朝阳区",
+		Details: []*diffDetail{
+			{Id: 1, SkuCode: "SKU001", Quantity: 1},
+			{Id: 2, SkuCode: "SKU002", Quantity: 2},
+		},
+	}
+	newData := &diffOrder{
+		Id:      1,
+		Remark:  "修改",
+		Address: "北京市朝阳区2",
+		Details: []*diffDetail{
+			{Id: 1, SkuCode: "SKU001", Quantity: 4},
+			{SkuCode: "SKU003", Quantity: 3},
+		},
+	}
+
+	changes := DiffData(oldData, newData)
+	assert.Len(t, changes, 4)
+	assert.Equal(t, "收货地址: 北京市朝阳区 → 北京市朝阳区2", changes[0].String())
+	assert.Equal(t, "销售单明细[1].订单数量: 1 → 4", changes[1].String())
+	assert.Equal(t, "Details[1].Quantity", changes[1].Field)
+	assert.Equal(t, "Details[new#1]", changes[2].Field)
+	assert.Equal(t, "新增(SKU编码:SKU003,订单数量:3)", changes[2].New)
+	assert.Equal(t, "Details[2]", changes[3].Field)
+	assert.Equal(t, "删除(SKU编码:SKU002,订单数量:2)", changes[3].Old)
+
+	// 无变化
+	assert.Empty(t, DiffData(oldData, oldData))
+}
+
+func TestCloneValue(t *testing.T) {
+	src := &diffOrder{Id: 1, Address: "北京", Details: []*diffDetail{{Id: 1, SkuCode: "SKU001"}}}
+	dst := &diffOrder{}
+	cloneValue(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem())
+
+	// 修改源数据不影响拷贝
+	src.Details[0].SkuCode = "SKU002"
+	assert.Equal(t, "SKU001", dst.Details[0].SkuCode)
+	assert.Equal(t, "北京", dst.Address)
+}
@@ -0,0 +1,146 @@
+package base
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// 有变化的字段 | 对比加载时的快照,返回有变化的表字段名;未加载数据时返回nil
+//
+// 只对比主表可更新的字段,不含主键、版本号、创建和更新信息,一对多子表数据不参与对比
+func (b *BaseModel[T]) ChangedFields() []string {
+	entity, err := b.GetCurrEntity()
+	if err != nil || b.snapshot == nil || entityId(b.snapshot) != entityId(entity) {
+		return nil
+	}
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return nil
+	}
+	return changedColumns(b.Db.Statement.Context, modelSchema, reflect.ValueOf(b.snapshot).Elem(), reflect.ValueOf(entity).Elem())
+}
+
+// 更新指定字段 | 只更新fields中的字段,用于按请求中出现的字段部分更新
+//
+// fields支持结构体字段名、表字段名和json名;一对多字段会同步子表数据
+func (b *BaseModel[T]) UpdateFields(fields ...string) (*T, error) {
+	// 读取业务实体 | 校验是否为空
+	entity, err := b.GetCurrEntity()
+	if err != nil {
+		return nil, fmt.Errorf("[BASE]中业务实体为空,请开发检查")
+	}
+	if entityId(entity) == 0 {
+		return nil, fmt.Errorf("[%s]数据Id为空,不能更新,请开发检查", b.TableName)
+	}
+
+	// 解析字段
+	columns, relations, err := b.resolveFields(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// 读取旧数据并校验字段编辑权限
+	oldData, err := b.originData(entity)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkEditable(oldData, entity); err != nil {
+		return nil, err
+	}
+
+	// 执行更新操作、写入领域事件、记录日志 | 同一个事务中执行
+	err = b.Transaction(func(tx *gorm.DB) error {
+		if err := b.updateWithVersion(tx, entity, columns); err != nil {
+			return err
+		}
+		if len(relations) > 0 {
+			if err := b.syncAssociations(tx, entity, oldData, relations...); err != nil {
+				return err
+			}
+		}
+		if err := b.FlushEvents(entity); err != nil {
+			return err
+		}
+		return b.RecordLog(LogTypeUpdate, "更新", oldData, entity)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 更新快照
+	b.takeSnapshot(entity)
+	return entity, nil
+}
+
+// 解析更新字段 | 返回表字段名和一对多字段名
+func (b *BaseModel[T]) resolveFields(fields []string) ([]string, []string, error) {
+	if len(fields) == 0 {
+		return nil, nil, fmt.Errorf("[%s]更新的字段不能为空,请开发检查", b.TableName)
+	}
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := make([]string, 0, len(fields))
+	relations := make([]string, 0)
+	for _, name := range fields {
+		// 一对多字段
+		if rel := lookUpHasMany(modelSchema, name); rel != nil {
+			if !slices.Contains(relations, rel.Name) {
+				relations = append(relations, rel.Name)
+			}
+			continue
+		}
+
+		// 表字段
+		field := lookUpField(modelSchema, name)
+		if field == nil || field.DBName == "" {
+			return nil, nil, fmt.Errorf("[%s]字段[%s]不存在,请开发检查", b.TableName, name)
+		}
+		if field.Tag.Get("lock") == "version" {
+			continue
+		}
+		if !field.Updatable || field.PrimaryKey || slices.Contains(OmitCreateFileds, field.DBName) || slices.Contains(OmitUpdateFileds, field.DBName) {
+			return nil, nil, fmt.Errorf("[%s]字段[%s]不允许更新,请开发检查", b.TableName, name)
+		}
+		if !slices.Contains(columns, field.DBName) {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns, relations, nil
+}
+
+// 查询字段 | 按结构体字段名、表字段名或json名查询
+func lookUpField(modelSchema *schema.Schema, name string) *schema.Field {
+	if field := modelSchema.LookUpField(name); field != nil {
+		return field
+	}
+	for _, field := range modelSchema.Fields {
+		if jsonName(field.Tag) == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// 查询一对多字段 | 按结构体字段名或json名查询
+func lookUpHasMany(modelSchema *schema.Schema, name string) *schema.Relationship {
+	for _, rel := range modelSchema.Relationships.HasMany {
+		if rel.Name == name || jsonName(rel.Field.Tag) == name {
+			return rel
+		}
+	}
+	return nil
+}
+
+// json名
+func jsonName(tag reflect.StructTag) string {
+	name, _, _ := strings.Cut(tag.Get("json"), ",")
+	return name
+}
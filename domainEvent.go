@@ -0,0 +1,107 @@
+package base
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/jianyuezhexue/base/outbox"
+)
+
+// 领域事件
+type domainEvent struct {
+	Topic   string // 事件名称
+	Payload any    // 事件内容
+	flush   *int   // 写入批次 | 为空表示未写入outbox表
+}
+
+// 记录领域事件 | 暂存在模型中,随Create,Update,EventExecution在同一个事务中写入outbox表
+func (b *BaseModel[T]) RaiseEvent(topic string, payload any) {
+	b.domainEvents = append(b.domainEvents, &domainEvent{Topic: topic, Payload: payload})
+}
+
+// 写入领域事件 | data为已落库的数据,其Id作为聚合Id;模型和data上暂存的事件都会写入
+//
+// 使用事务Db,事务提交后清空已写入的事件,回滚时保留,重试时重新写入
+func (b *BaseModel[T]) FlushEvents(data *T) error {
+	aggregateId := entityId(data)
+	if err := b.writeEvents(b, aggregateId); err != nil {
+		return err
+	}
+	if owner := modelOf(data); owner != b {
+		return b.writeEvents(owner, aggregateId)
+	}
+	return nil
+}
+
+// 写入owner上暂存的领域事件 | 跳过已写入的事件
+func (b *BaseModel[T]) writeEvents(owner *BaseModel[T], aggregateId uint64) error {
+	if owner == nil {
+		return nil
+	}
+	events := make([]*domainEvent, 0, len(owner.domainEvents))
+	for _, event := range owner.domainEvents {
+		if event.flush == nil {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	// 组合消息
+	messages := make([]*outbox.Message, 0, len(events))
+	for _, event := range events {
+		payload, err := json.Marshal(event.Payload)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, &outbox.Message{
+			Topic:         event.Topic,
+			AggregateType: b.TableName,
+			AggregateId:   aggregateId,
+			Payload:       string(payload),
+			Status:        outbox.StatusPending,
+		})
+	}
+
+	// 写入outbox表
+	err := b.Tx().Create(&messages).Error
+	if err != nil {
+		return err
+	}
+
+	// 标记本批次已写入 | 提交后移除,回滚后恢复为未写入
+	flush := new(int)
+	for _, event := range events {
+		event.flush = flush
+	}
+	b.OnRollback(func() {
+		for _, event := range events {
+			if event.flush == flush {
+				event.flush = nil
+			}
+		}
+	})
+	b.OnCommit(func() {
+		owner.domainEvents = slices.DeleteFunc(owner.domainEvents, func(event *domainEvent) bool {
+			return event.flush == flush
+		})
+	})
+	return nil
+}
+
+// 数据所属的模型 | 业务实体嵌入BaseModel时返回,否则为nil
+func modelOf[T any](data *T) *BaseModel[T] {
+	if data == nil {
+		return nil
+	}
+	if holder, ok := any(data).(interface{ baseModel() *BaseModel[T] }); ok {
+		return holder.baseModel()
+	}
+	return nil
+}
+
+// 返回模型自身 | 业务实体嵌入BaseModel后可以取到
+func (b *BaseModel[T]) baseModel() *BaseModel[T] {
+	return b
+}
@@ -1 +1,21 @@
 package salesOrder
+
+import (
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// 确认订单 | 自带事务,在已开启事务的Logic层中调用时加入外层事务
+func (m *SalesOrderEntity) Confirm() error {
+	// 初始化状态机
+	err := m.InitStateMachine(strconv.Itoa(m.Status), Events, m.EventCallBack)
+	if err != nil {
+		return err
+	}
+
+	// 执行确认事件
+	return m.Transaction(func(tx *gorm.DB) error {
+		return m.EventExecution(strconv.Itoa(m.Status), "confirm", "确认订单")
+	})
+}
@@ -2,9 +2,9 @@ package salesOrder
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 
-	"github.com/gin-gonic/gin"
 	"github.com/jianyuezhexue/base"
 	"github.com/jianyuezhexue/base/db"
 	"github.com/jianyuezhexue/base/exampleDomain/salesOrderDetail"
@@ -14,16 +14,19 @@ import (
 // 业务模型接口定义
 type SalesOrderInterface interface {
 	base.BaseModelInterface[SalesOrderEntity]
+	Confirm() error // 确认订单
 }
 
 // 业务模型实体
 type SalesOrderEntity struct {
 	base.BaseModel[SalesOrderEntity]
-	OrderId           string                                     `json:"orderId" comment:"订单号"`                                                           // SO号
-	Status            int                                        `json:"status"  comment:"订单状态"`                                                          // 订单状态
-	CustomerName      string                                     `json:"customerName" comment:"客户姓名"`                                                     //  客户姓名                                                              // 订单状态
-	Address           string                                     `json:"address" comment:"收货地址"`                                                          // 收货地址
-	SalesOrderDetails []*salesOrderDetail.SalesOrderDetailEntity `json:"salesOrderDetails" gorm:"foreignKey:OrderId;references:OrderId;" comment:"销售单明细"` // 发货单详情
+	OrderId           string                                     `json:"orderId" comment:"订单号"`                                                                              // SO号
+	Status            int                                        `json:"status"  comment:"订单状态"`                                                                             // 订单状态
+	CustomerName      string                                     `json:"customerName" comment:"客户姓名"`                                                                        //  客户姓名                                                              // 订单状态
+	Address           string                                     `json:"address" comment:"收货地址"`                                                                             // 收货地址
+	SalesOrderDetails []*salesOrderDetail.SalesOrderDetailEntity `json:"salesOrderDetails" gorm:"foreignKey:OrderId;references:OrderId;" onDelete:"cascade" comment:"销售单明细"` // 发货单详情
+	Version           int64                                      `json:"version" lock:"version"`                                                                             // 版本号 | 乐观锁
+	DeletedBy         string                                     `json:"-" gorm:"<-:update"`                                                                                 // 删除人
 }
 
 // 数据表名
@@ -48,10 +51,19 @@ var Events = []fsm.EventDesc{
 	{Src: []string{"4", "5"}, Name: "returnGoods", Dst: "6"},
 }
 
-// 实例化实体业务模型
-func NewSalesOrderEntity(ctx *gin.Context, opt ...base.Option[SalesOrderEntity]) SalesOrderInterface {
+// 数据范围策略 | 管理员查看全部订单,销售只能查看自己创建的订单
+var DataScopePolicy = &base.DataScopePolicy{
+	Roles: map[string]base.DataScopeRule{
+		"admin": {Scope: base.DataScopeAll},
+		"sales": {Scope: base.DataScopeSelf},
+	},
+}
+
+// 实例化实体业务模型 | 默认应用数据范围策略,系统任务使用WithoutPermission不应用
+func NewSalesOrderEntity(ctx base.ModelContext, opt ...base.Option[SalesOrderEntity]) SalesOrderInterface {
 	entity := &SalesOrderEntity{}
-	entity.BaseModel = base.NewBaseModel(ctx, db.InitDb(), entity.TableName(), entity)
+	entity.BaseModel = base.NewBaseModelWithContext(ctx, db.InitDb(), entity.TableName(), entity)
+	base.WithDataScopePolicy[SalesOrderEntity](DataScopePolicy)(&entity.BaseModel)
 
 	// 自定义配置选项
 	if len(opt) > 0 {
@@ -97,11 +109,28 @@ func (m *SalesOrderEntity) Complete() error {
 	return nil
 }
 
+// ValidateDelete 删除校验
+func (m *SalesOrderEntity) ValidateDelete() error {
+	// 只有制单状态的订单可以删除
+	if m.Status != 0 {
+		return fmt.Errorf("订单[%s]已确认,不允许删除", m.OrderId)
+	}
+	return nil
+}
+
 // EventCallBack 事件回调
 func (m *SalesOrderEntity) EventCallBack(_ context.Context, e *fsm.Event) {
 	// 维护状态为最新状态
 	m.Status, _ = strconv.Atoi(e.Dst)
 
+	// 记录领域事件 | 和状态变更在同一个事务中写入outbox表
+	if e.Event == "confirm" {
+		m.RaiseEvent("OrderConfirmed", map[string]any{"orderId": m.OrderId})
+	}
+
 	// 更多逻辑...
-	// 举例: 异步推送一条用户操作日志
+	// 举例: 事务提交后异步推送一条用户操作日志
+	m.OnCommit(func() {
+		// go notify(...)
+	})
 }
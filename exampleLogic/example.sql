@@ -7,13 +7,16 @@ create table sales_order
     status         tinyint      default 0                 not null comment '订单状态',
     customer_name  varchar(30)  default ''                not null comment '客户姓名',
     address        varchar(500) default ''                not null comment '收货地址',
+    version        int          default 0                 not null comment '版本号',
     created_at     datetime     default CURRENT_TIMESTAMP not null comment '创建时间',
     updated_at     datetime     default CURRENT_TIMESTAMP null comment '修改时间',
     deleted_at     datetime                               null,
+    deleted_by     varchar(20)  default ''                not null comment '删除人id',
     create_by      varchar(20)  default ''                not null comment '创建人id',
     create_by_name varchar(20)  default ''                not null,
     update_by      varchar(20)  default ''                not null comment '修改人id',
-    update_by_name varchar(20)  default ''                not null
+    update_by_name varchar(20)  default ''                not null,
+    index idx_order_id (order_id)
 ) comment '销售订单';
 
 -- auto-generated definition
@@ -29,8 +32,44 @@ create table sales_order_detail
     created_at     datetime       default CURRENT_TIMESTAMP not null comment '创建时间',
     updated_at     datetime       default CURRENT_TIMESTAMP null comment '修改时间',
     deleted_at     datetime                                 null,
+    deleted_by     varchar(20)    default ''                not null comment '删除人id',
     create_by      varchar(20)    default ''                not null comment '创建人id',
     create_by_name varchar(20)    default ''                not null,
     update_by      varchar(20)    default ''                not null comment '修改人id',
     update_by_name varchar(20)    default ''                not null
-) comment '销售订单明细';
\ No newline at end of file
+) comment '销售订单明细';
+
+-- auto-generated definition
+create table operation_log
+(
+    id             int auto_increment primary key,
+    table_name     varchar(100) default ''                not null comment '业务表名',
+    entity_id      int          default 0                 not null comment '业务数据id',
+    operator_id    varchar(20)  default ''                not null comment '操作人id',
+    operator_name  varchar(20)  default ''                not null comment '操作人名称',
+    operation_type varchar(50)  default ''                not null comment '操作类型',
+    operation_name varchar(50)  default ''                not null comment '操作类型名称',
+    old_data       longtext                               null comment '旧数据快照',
+    new_data       longtext                               null comment '新数据快照',
+    changes        longtext                               null comment '字段变更',
+    created_at     datetime     default CURRENT_TIMESTAMP not null comment '操作时间',
+    index idx_table_entity (table_name, entity_id)
+) comment '操作日志';
+
+-- auto-generated definition
+create table outbox
+(
+    id             int auto_increment primary key,
+    topic          varchar(100) default ''                not null comment '事件名称',
+    aggregate_type varchar(100) default ''                not null comment '聚合类型',
+    aggregate_id   int          default 0                 not null comment '聚合id',
+    payload        longtext                               null comment '事件内容',
+    status         tinyint      default 0                 not null comment '状态 0待发送 1已发送 2发送失败',
+    attempts       int          default 0                 not null comment '已尝试次数',
+    last_error     varchar(500) default ''                not null comment '最近一次失败原因',
+    next_retry_at  datetime                               null comment '下次重试时间',
+    delivered_at   datetime                               null comment '发送时间',
+    created_at     datetime     default CURRENT_TIMESTAMP not null comment '创建时间',
+    index idx_status_id (status, id),
+    index idx_aggregate (aggregate_type, aggregate_id)
+) comment '发件箱';
\ No newline at end of file
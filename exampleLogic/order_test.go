@@ -1,6 +1,7 @@
 package examplelogic
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,8 +11,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jianyuezhexue/base"
+	"github.com/jianyuezhexue/base/db"
 	"github.com/jianyuezhexue/base/exampleDomain/salesOrder"
 	"github.com/jianyuezhexue/base/exampleDomain/salesOrderDetail"
+	"github.com/jianyuezhexue/base/outbox"
 	"github.com/looplab/fsm"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
@@ -267,3 +270,585 @@ func TestEventExecution(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 3, saleOrderData.Status)
 }
+
+// 操作记录接口
+func TestHistory(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+
+	// 1. 实例化业务实体
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+
+	// 2. 查询操作记录
+	list, err := salesOrderEntity.History(1)
+	assert.Nil(t, err)
+
+	// 3. 返回数据
+	bytes, _ := json.MarshalIndent(list, "", "  ")
+	fmt.Printf("%s", string(bytes))
+}
+
+// 乐观锁 | 两个用户同时编辑同一条数据,后提交的返回冲突
+func TestUpdateVersionConflict(t *testing.T) {
+	// 0. 模拟数据
+	ctxA := &gin.Context{Request: &http.Request{}}
+	ctxA.Set("currUserId", "1")
+	ctxA.Set("currUserName", "张三")
+	ctxB := &gin.Context{Request: &http.Request{}}
+	ctxB.Set("currUserId", "2")
+	ctxB.Set("currUserName", "李四")
+
+	// 1. 两个用户同时加载数据
+	entityA := salesOrder.NewSalesOrderEntity(ctxA)
+	orderA, err := entityA.LoadById(1)
+	assert.Nil(t, err)
+	entityB := salesOrder.NewSalesOrderEntity(ctxB)
+	orderB, err := entityB.LoadById(1)
+	assert.Nil(t, err)
+
+	// 2. 用户A先提交
+	orderA.Address = "北京市朝阳区A"
+	_, err = entityA.Update()
+	assert.Nil(t, err)
+
+	// 3. 用户B后提交,版本冲突
+	orderB.Address = "北京市朝阳区B"
+	_, err = entityB.Update()
+	assert.ErrorIs(t, err, base.ErrVersionConflict)
+}
+
+// 加锁查询 | 部分发货前锁定订单
+func TestLoadByIdForUpdate(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+
+	// 1. 实例化业务实体
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+
+	// 2. 事务外加锁查询报错
+	_, err := salesOrderEntity.LoadByIdForUpdate(1)
+	assert.NotNil(t, err)
+
+	// 3. 事务中加锁查询
+	err = salesOrderEntity.Transaction(func(tx *gorm.DB) error {
+		preloads := map[string][]any{"SalesOrderDetails": {}}
+		_, err2 := salesOrderEntity.LoadByIdForUpdate(1, preloads)
+		if err2 != nil {
+			return err2
+		}
+
+		// 2. more...
+
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+// 嵌套事务 | Logic层开启事务后编排自带事务的能力
+func TestNestedTransaction(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+
+	// 1. 实例化业务实体
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+
+	// 2. 开启事务
+	err := salesOrderEntity.Transaction(func(tx *gorm.DB) error {
+		// 1. 加锁查询数据
+		_, err2 := salesOrderEntity.LoadByIdForUpdate(1)
+		if err2 != nil {
+			return err2
+		}
+
+		// 2. 保存点内执行失败只回滚保存点
+		err2 = salesOrderEntity.TransactionWithPropagation(base.PropagationNested, func(tx *gorm.DB) error {
+			return fmt.Errorf("模拟失败")
+		})
+		assert.NotNil(t, err2)
+
+		// 3. 确认订单 | 加入外层事务
+		return salesOrderEntity.Confirm()
+	})
+	assert.Nil(t, err)
+}
+
+// 事务回调 | 提交后才执行通知
+func TestTransactionCallback(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+
+	// 1. 实例化业务实体
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+
+	// 2. 事务提交后执行
+	committed, rollbacked := false, false
+	err := salesOrderEntity.Transaction(func(tx *gorm.DB) error {
+		salesOrderEntity.OnCommit(func() { committed = true })
+		salesOrderEntity.OnRollback(func() { rollbacked = true })
+		assert.False(t, committed)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.True(t, committed)
+	assert.False(t, rollbacked)
+
+	// 3. 事务回滚后执行
+	committed, rollbacked = false, false
+	err = salesOrderEntity.Transaction(func(tx *gorm.DB) error {
+		salesOrderEntity.OnCommit(func() { committed = true })
+		salesOrderEntity.OnRollback(func() { rollbacked = true })
+		return fmt.Errorf("模拟失败")
+	})
+	assert.NotNil(t, err)
+	assert.False(t, committed)
+	assert.True(t, rollbacked)
+}
+
+// 发件箱 | 确认订单后中继发布OrderConfirmed事件
+func TestOutboxRelay(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+
+	// 1. 实例化业务实体
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+
+	// 2. 查询制单状态的数据并确认
+	_, err := salesOrderEntity.LoadData(func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ?", 0)
+	})
+	assert.Nil(t, err)
+	err = salesOrderEntity.Confirm()
+	assert.Nil(t, err)
+
+	// 3. 中继发布消息
+	publisher := outbox.NewMemoryPublisher()
+	relay := outbox.NewRelay(db.InitDb(), publisher)
+	_, err = relay.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.NotEmpty(t, publisher.Messages())
+}
+
+// 读己之写 | 事务内新增的数据,事务内查询可见
+func TestReadYourWrites(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "1")
+	ctx.Set("currUserName", "张三")
+
+	// 模拟请求数据
+	reqData := &salesOrder.CreateSalesOrder{
+		OrderId:      fmt.Sprintf("SO%d", time.Now().UnixMicro()),
+		CustomerName: "张三",
+		Address:      "北京市朝阳区",
+	}
+
+	// 1. 实例化业务实体
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+	_, err := salesOrderEntity.SetData(reqData)
+	assert.Nil(t, err)
+
+	// 2. 开启事务
+	err = salesOrderEntity.Transaction(func(tx *gorm.DB) error {
+		// 1. 新增数据
+		created, err2 := salesOrderEntity.Create()
+		if err2 != nil {
+			return err2
+		}
+
+		// 2. 事务内查询 | 未提交的数据可见
+		exist, err2 := salesOrderEntity.CheckBusinessCodeExist("order_id", reqData.OrderId)
+		assert.Nil(t, err2)
+		assert.True(t, exist)
+		list, err2 := salesOrderEntity.ListByIds([]uint64{created.Id})
+		assert.Nil(t, err2)
+		assert.Len(t, list, 1)
+
+		// 3. 回滚
+		return fmt.Errorf("模拟回滚")
+	})
+	assert.NotNil(t, err)
+
+	// 3. 事务外查询 | 已回滚不可见
+	exist, err := salesOrderEntity.CheckBusinessCodeExist("order_id", reqData.OrderId)
+	assert.Nil(t, err)
+	assert.False(t, exist)
+}
+
+// 非HTTP场景 | 使用context.Context构造业务实体
+func TestNewContext(t *testing.T) {
+	// 0. 模拟数据
+	ctx := base.NewContext(context.Background(), "1", "定时任务")
+
+	// 1. 实例化业务实体
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+
+	// 2. 查询数据
+	_, err := salesOrderEntity.LoadById(1)
+	assert.Nil(t, err)
+
+	// 3. 事务中更新
+	err = salesOrderEntity.Transaction(func(tx *gorm.DB) error {
+		_, err2 := salesOrderEntity.Update()
+		return err2
+	})
+	assert.Nil(t, err)
+}
+
+// 分页查询 | 一次调用返回分页结果
+func TestListPage(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+
+	// 模拟请求数据
+	reqData := salesOrder.SearchSalesOrder{
+		Page:             1,
+		PageSize:         10,
+		CustomerNameLike: "张",
+	}
+
+	// 1. 实例化业务实体 | 并发统计和查询
+	withConcurrent := base.WithConcurrentPage[salesOrder.SalesOrderEntity]()
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx, withConcurrent)
+
+	// 2. 分页查询
+	resp, err := salesOrderEntity.ListPage(reqData)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), resp.Page)
+	assert.Equal(t, int64(10), resp.PageSize)
+	assert.Equal(t, resp.Total > 10, resp.HasNext)
+}
+
+// 分批遍历 | 导出、数据修复
+func TestEach(t *testing.T) {
+	// 0. 模拟数据
+	ctx := base.NewContext(context.Background(), "1", "数据修复")
+
+	// 1. 实例化业务实体
+	preloads := map[string][]any{"SalesOrderDetails": {}}
+	withPreloads := base.WithPreloads[salesOrder.SalesOrderEntity](preloads)
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx, withPreloads)
+
+	// 2. 分批遍历
+	var lastId uint64
+	err := salesOrderEntity.Each(2, func(batch []*salesOrder.SalesOrderEntity) error {
+		for _, item := range batch {
+			assert.Greater(t, item.Id, lastId)
+			lastId = item.Id
+		}
+		return nil
+	}, salesOrderEntity.MakeConditon(salesOrder.SearchSalesOrder{CustomerNameLike: "张"}))
+	assert.Nil(t, err)
+}
+
+// 批量新增 | 导入订单
+func TestCreateBatch(t *testing.T) {
+	// 0. 模拟数据
+	ctx := base.NewContext(context.Background(), "1", "导入任务")
+	items := make([]*salesOrder.SalesOrderEntity, 0)
+	for i := 0; i < 5; i++ {
+		item := &salesOrder.SalesOrderEntity{
+			OrderId:      fmt.Sprintf("SO%d%d", time.Now().UnixMicro(), i),
+			CustomerName: "张三",
+			Address:      "北京市朝阳区",
+		}
+		items = append(items, item)
+	}
+
+	// 1. 实例化业务实体
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+
+	// 2. 批量新增
+	result, err := salesOrderEntity.CreateBatch(items, 2)
+	assert.Nil(t, err)
+	assert.Nil(t, result.Err())
+	assert.Equal(t, 5, result.Success)
+}
+
+// 按业务编码新增或更新 | 对接推送订单
+func TestUpsertByBusinessCode(t *testing.T) {
+	// 0. 模拟数据
+	ctx := base.NewContext(context.Background(), "1", "订单对接")
+	orderId := fmt.Sprintf("SO%d", time.Now().UnixMicro())
+
+	// 1. 实例化业务实体
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+
+	// 2. 第一次推送新增
+	inserted, err := salesOrderEntity.UpsertByBusinessCode("order_id", &salesOrder.SalesOrderEntity{OrderId: orderId, CustomerName: "张三", Address: "北京市朝阳区"})
+	assert.Nil(t, err)
+	assert.True(t, inserted)
+
+	// 3. 第二次推送更新
+	data := &salesOrder.SalesOrderEntity{OrderId: orderId, CustomerName: "张三", Address: "北京市海淀区"}
+	inserted, err = salesOrderEntity.UpsertByBusinessCode("order_id", data)
+	assert.Nil(t, err)
+	assert.False(t, inserted)
+	assert.NotZero(t, data.Id)
+}
+
+// 按条件批量更新 | 关闭30天前的制单数据
+func TestUpdateWhere(t *testing.T) {
+	// 0. 模拟数据
+	ctx := base.NewContext(context.Background(), "1", "定时任务")
+
+	// 1. 实例化业务实体
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+
+	// 2. 批量更新
+	cond := func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ? and created_at < ?", 0, time.Now().AddDate(0, 0, -30))
+	}
+	_, err := salesOrderEntity.UpdateWhere(cond, map[string]any{"status": 7})
+	assert.Nil(t, err)
+}
+
+// 回收站 | 删除后恢复
+func TestRestore(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+
+	// 1. 实例化业务实体 | 恢复时校验订单号唯一
+	withBusinessCodes := base.WithBusinessCodes[salesOrder.SalesOrderEntity]("order_id")
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx, withBusinessCodes)
+
+	// 2. 新增后删除
+	_, err := salesOrderEntity.SetData(&salesOrder.CreateSalesOrder{
+		OrderId:      fmt.Sprintf("SO%d", time.Now().UnixMicro()),
+		CustomerName: "张三",
+		Address:      "北京市朝阳区",
+	})
+	assert.Nil(t, err)
+	created, err := salesOrderEntity.Create()
+	assert.Nil(t, err)
+	err = salesOrderEntity.Del(created.Id)
+	assert.Nil(t, err)
+
+	// 3. 回收站中可以查到
+	trashed, err := salesOrderEntity.ListTrashed(func(db *gorm.DB) *gorm.DB {
+		return db.Where("id = ?", created.Id)
+	})
+	assert.Nil(t, err)
+	assert.Len(t, trashed, 1)
+	assert.Equal(t, "110", trashed[0].DeletedBy)
+
+	// 4. 恢复
+	err = salesOrderEntity.Restore(created.Id)
+	assert.Nil(t, err)
+	_, err = salesOrderEntity.GetById(created.Id)
+	assert.Nil(t, err)
+}
+
+// 删除 | 应用权限条件,已确认的订单不允许删除
+func TestDel(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+
+	// 1. 实例化业务实体 | 只能删除自己创建的数据
+	withPermission := base.WithPermissionConditons[salesOrder.SalesOrderEntity](func(db *gorm.DB) *gorm.DB {
+		return db.Where("create_by = ?", "110")
+	})
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx, withPermission)
+
+	// 2. 不存在的数据整体不删除
+	err := salesOrderEntity.Del(0)
+	assert.NotNil(t, err)
+
+	// 3. 已确认的订单不允许删除
+	confirmed, err := salesOrderEntity.List(func(db *gorm.DB) *gorm.DB {
+		return db.Where("status > ?", 0).Limit(1)
+	})
+	assert.Nil(t, err)
+	for _, item := range confirmed {
+		err = salesOrderEntity.Del(item.Id)
+		assert.NotNil(t, err)
+	}
+}
+
+// 级联删除 | 删除订单时同时删除明细
+func TestDelCascade(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+	orderId := fmt.Sprintf("SO%d", time.Now().UnixMicro())
+
+	// 1. 实例化业务实体
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+
+	// 2. 新增订单和明细
+	_, err := salesOrderEntity.SetData(&salesOrder.CreateSalesOrder{
+		OrderId:      orderId,
+		CustomerName: "张三",
+		Address:      "北京市朝阳区",
+		SalesOrderDetails: []*salesOrderDetail.CreateSalesOrderDetail{
+			{OrderId: orderId, SkuCode: "SKU001", OrderQuantity: 1},
+		},
+	})
+	assert.Nil(t, err)
+	created, err := salesOrderEntity.Create()
+	assert.Nil(t, err)
+
+	// 3. 删除订单
+	err = salesOrderEntity.Del(created.Id)
+	assert.Nil(t, err)
+
+	// 4. 明细同时被删除
+	var count int64
+	err = db.InitDb().Table("sales_order_detail").Where("order_id = ? and deleted_at is null", orderId).Count(&count).Error
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestUpdateSyncDetails(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+	orderId := fmt.Sprintf("SO%d", time.Now().UnixMicro())
+
+	// 1. 新增订单和两条明细 | 明细的SO号自动回填
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+	_, err := salesOrderEntity.SetData(&salesOrder.CreateSalesOrder{
+		OrderId:      orderId,
+		CustomerName: "张三",
+		Address:      "北京市朝阳区",
+		SalesOrderDetails: []*salesOrderDetail.CreateSalesOrderDetail{
+			{SkuCode: "SKU001", OrderQuantity: 1},
+			{SkuCode: "SKU002", OrderQuantity: 2},
+		},
+	})
+	assert.Nil(t, err)
+	created, err := salesOrderEntity.Create()
+	assert.Nil(t, err)
+
+	// 2. 加载数据 | 删除第二条明细,修改第一条明细,新增一条明细
+	salesOrderEntity = salesOrder.NewSalesOrderEntity(ctx)
+	loaded, err := salesOrderEntity.LoadById(created.Id, map[string][]any{"SalesOrderDetails": {}})
+	assert.Nil(t, err)
+	_, err = salesOrderEntity.SetData(&salesOrder.UpdateSalesOrder{
+		Id:           created.Id,
+		OrderId:      orderId,
+		CustomerName: "张三",
+		Address:      "北京市朝阳区",
+		SalesOrderDetails: []*salesOrderDetail.UpdateSalesOrderDetail{
+			{Id: int(loaded.SalesOrderDetails[0].Id), SkuCode: "SKU001", OrderQuantity: 10},
+			{SkuCode: "SKU003", OrderQuantity: 3},
+		},
+	})
+	assert.Nil(t, err)
+	_, err = salesOrderEntity.Update()
+	assert.Nil(t, err)
+
+	// 3. 明细与提交的数据一致
+	skuCodes := make([]string, 0)
+	err = db.InitDb().Table("sales_order_detail").Where("order_id = ? and deleted_at is null", orderId).Order("id asc").Pluck("sku_code", &skuCodes).Error
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"SKU001", "SKU003"}, skuCodes)
+}
+
+func TestUpdateFields(t *testing.T) {
+	// 0. 模拟数据
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+	orderId := fmt.Sprintf("SO%d", time.Now().UnixMicro())
+
+	// 1. 新增订单
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+	_, err := salesOrderEntity.SetData(&salesOrder.CreateSalesOrder{OrderId: orderId, CustomerName: "张三", Address: "北京市朝阳区"})
+	assert.Nil(t, err)
+	created, err := salesOrderEntity.Create()
+	assert.Nil(t, err)
+
+	// 2. 加载数据后只修改地址
+	salesOrderEntity = salesOrder.NewSalesOrderEntity(ctx)
+	loaded, err := salesOrderEntity.LoadById(created.Id)
+	assert.Nil(t, err)
+	loaded.Address = "北京市海淀区"
+	assert.Equal(t, []string{"address"}, salesOrderEntity.ChangedFields())
+
+	// 3. 按请求中的字段更新 | 未出现的客户名称不会被覆盖
+	loaded.CustomerName = ""
+	_, err = salesOrderEntity.UpdateFields("address")
+	assert.Nil(t, err)
+
+	// 4. 校验数据
+	row := map[string]any{}
+	err = db.InitDb().Table("sales_order").Select("customer_name", "address").Where("id = ?", created.Id).Take(&row).Error
+	assert.Nil(t, err)
+	assert.Equal(t, "张三", row["customer_name"])
+	assert.Equal(t, "北京市海淀区", row["address"])
+}
+
+func TestLoadByIdPermission(t *testing.T) {
+	// 0. 模拟数据 | 用户110创建订单
+	ctx := &gin.Context{Request: &http.Request{}}
+	ctx.Set("currUserId", "110")
+	ctx.Set("currUserName", "张三")
+	orderId := fmt.Sprintf("SO%d", time.Now().UnixMicro())
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+	_, err := salesOrderEntity.SetData(&salesOrder.CreateSalesOrder{OrderId: orderId, CustomerName: "张三", Address: "北京市朝阳区"})
+	assert.Nil(t, err)
+	created, err := salesOrderEntity.Create()
+	assert.Nil(t, err)
+
+	// 1. 用户120只能查看自己创建的订单
+	ctx2 := base.NewContext(context.Background(), "120", "李四")
+	permission := base.WithPermissionConditons[salesOrder.SalesOrderEntity](func(db *gorm.DB) *gorm.DB {
+		return db.Where("sales_order.create_by = ?", "120")
+	})
+	_, err = salesOrder.NewSalesOrderEntity(ctx2, permission).LoadById(created.Id)
+	assert.NotNil(t, err)
+	_, err = salesOrder.NewSalesOrderEntity(ctx2, permission).GetById(created.Id)
+	assert.NotNil(t, err)
+
+	// 2. 系统任务不应用权限条件
+	_, err = salesOrder.NewSalesOrderEntity(ctx2, permission, base.WithoutPermission[salesOrder.SalesOrderEntity]()).LoadById(created.Id)
+	assert.Nil(t, err)
+}
+
+func TestDataScopePolicy(t *testing.T) {
+	// 0. 模拟数据 | 用户110创建订单
+	ctx := base.NewContext(context.Background(), "110", "张三")
+	orderId := fmt.Sprintf("SO%d", time.Now().UnixMicro())
+	salesOrderEntity := salesOrder.NewSalesOrderEntity(ctx)
+	_, err := salesOrderEntity.SetData(&salesOrder.CreateSalesOrder{OrderId: orderId, CustomerName: "张三", Address: "北京市朝阳区"})
+	assert.Nil(t, err)
+	created, err := salesOrderEntity.Create()
+	assert.Nil(t, err)
+
+	// 1. 销售只能查看自己创建的订单 | 默认应用数据范围策略
+	ctx2 := base.NewContext(context.Background(), "120", "李四")
+	base.SetIdentity(ctx2, &base.Identity{UserId: "120", Roles: []string{"sales"}})
+	_, err = salesOrder.NewSalesOrderEntity(ctx2).GetById(created.Id)
+	assert.NotNil(t, err)
+	base.SetIdentity(ctx, &base.Identity{UserId: "110", Roles: []string{"sales"}})
+	_, err = salesOrder.NewSalesOrderEntity(ctx).GetById(created.Id)
+	assert.Nil(t, err)
+
+	// 2. 管理员查看全部订单
+	base.SetIdentity(ctx2, &base.Identity{UserId: "120", Roles: []string{"admin"}})
+	_, err = salesOrder.NewSalesOrderEntity(ctx2).GetById(created.Id)
+	assert.Nil(t, err)
+
+	// 3. 没有角色时返回错误
+	ctx3 := base.NewContext(context.Background(), "130", "王五")
+	_, err = salesOrder.NewSalesOrderEntity(ctx3).GetById(created.Id)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,406 @@
+package base
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jianyuezhexue/base/db"
+)
+
+// 脱敏方式 | 字段标记 perm:"mask:phone"
+const (
+	MaskAll   = "all"   // 全部隐藏
+	MaskPhone = "phone" // 手机号 | 保留前3位和后4位
+	MaskName  = "name"  // 姓名 | 保留第一个字
+	MaskEmail = "email" // 邮箱 | 保留第一个字符和域名
+)
+
+// 字段权限 | 实体字段标记 perm:"view:admin,finance;edit:admin;mask:phone"
+//
+// view为可查看的角色,edit为可编辑的角色,未配置时不限制;没有查看权限时按mask脱敏,未配置mask时清空
+type fieldPermission struct {
+	View []string // 可查看的角色
+	Edit []string // 可编辑的角色
+	Mask string   // 脱敏方式
+}
+
+// 解析字段权限 | 未标记返回nil
+func parseFieldPermission(tag reflect.StructTag) *fieldPermission {
+	value := tag.Get("perm")
+	if value == "" {
+		return nil
+	}
+	perm := &fieldPermission{}
+	for _, item := range strings.Split(value, ";") {
+		key, val, _ := strings.Cut(strings.TrimSpace(item), ":")
+		switch key {
+		case "view":
+			perm.View = strings.Split(val, ",")
+		case "edit":
+			perm.Edit = strings.Split(val, ",")
+		case "mask":
+			perm.Mask = val
+		}
+	}
+	return perm
+}
+
+// 是否可查看
+func (p *fieldPermission) canView(roles []string) bool {
+	return len(p.View) == 0 || hasAnyRole(p.View, roles)
+}
+
+// 是否可编辑 | 不可查看的字段也不可编辑
+func (p *fieldPermission) canEdit(roles []string) bool {
+	return p.canView(roles) && (len(p.Edit) == 0 || hasAnyRole(p.Edit, roles))
+}
+
+// 是否有其中一个角色
+func hasAnyRole(allowed, roles []string) bool {
+	for _, role := range roles {
+		if slices.Contains(allowed, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// 字符串脱敏
+func maskString(style, value string) string {
+	if value == "" {
+		return ""
+	}
+	switch style {
+	case MaskPhone:
+		if len(value) >= 7 {
+			return value[:3] + "****" + value[len(value)-4:]
+		}
+	case MaskName:
+		_, size := utf8.DecodeRuneInString(value)
+		return value[:size] + strings.Repeat("*", utf8.RuneCountInString(value)-1)
+	case MaskEmail:
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			_, size := utf8.DecodeRuneInString(value)
+			return value[:size] + "***" + value[at:]
+		}
+	}
+	return "******"
+}
+
+// 当前用户的角色 | 读取不到用户身份时没有角色
+func (b *BaseModel[T]) currRoles() []string {
+	identity, err := IdentityFromContext(b.Ctx)
+	if err != nil {
+		return nil
+	}
+	return identity.Roles
+}
+
+// 字段脱敏 | 输出前调用,没有查看权限的字段按mask脱敏或清空,递归处理子表数据
+//
+// data为实体指针或实体切片;开启WithoutPermission时不处理
+func (b *BaseModel[T]) MaskFields(data any) error {
+	val := reflect.ValueOf(data)
+	if val.Kind() != reflect.Ptr && val.Kind() != reflect.Slice {
+		return fmt.Errorf("[%s]脱敏数据必须是指针或切片,请开发检查", b.TableName)
+	}
+	if b.SkipPermission {
+		return nil
+	}
+	maskValue(val, b.currRoles(), make(map[uintptr]struct{}))
+	return nil
+}
+
+// 递归脱敏 | 跳过gorm:"-"的字段(数据库连接,上下文,状态机等)
+func maskValue(val reflect.Value, roles []string, visited map[uintptr]struct{}) {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			return
+		}
+		if val.Kind() == reflect.Ptr {
+			if _, ok := visited[val.Pointer()]; ok {
+				return
+			}
+			visited[val.Pointer()] = struct{}{}
+		}
+		maskValue(val.Elem(), roles, visited)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			maskValue(val.Index(i), roles, visited)
+		}
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Type().Field(i)
+			if !field.IsExported() || strings.HasPrefix(field.Tag.Get("gorm"), "-") {
+				continue
+			}
+			fieldValue := val.Field(i)
+			perm := parseFieldPermission(field.Tag)
+			if perm == nil || perm.canView(roles) {
+				maskValue(fieldValue, roles, visited)
+				continue
+			}
+			if !fieldValue.CanSet() {
+				continue
+			}
+			if perm.Mask != "" && fieldValue.Kind() == reflect.String {
+				fieldValue.SetString(maskString(perm.Mask, fieldValue.String()))
+			} else {
+				fieldValue.Set(reflect.Zero(fieldValue.Type()))
+			}
+		}
+	}
+}
+
+// 操作记录脱敏 | 没有查看权限的字段按mask脱敏,未配置mask时去掉该条变更;开启WithoutPermission时不处理
+//
+// 子表数据新增和删除的摘要中有没有查看权限的字段时,只保留新增/删除
+func (b *BaseModel[T]) maskChanges(changes []FieldChange) []FieldChange {
+	if b.SkipPermission {
+		return changes
+	}
+	roles := b.currRoles()
+	entityType := reflect.TypeOf(new(T)).Elem()
+	list := make([]FieldChange, 0, len(changes))
+	for _, change := range changes {
+		perm, fieldType, isRow := lookupFieldPermission(entityType, change.Field, roles)
+		switch {
+		case perm != nil:
+			if perm.Mask == "" || fieldType.Kind() != reflect.String {
+				continue
+			}
+			change.Old, change.New = maskString(perm.Mask, change.Old), maskString(perm.Mask, change.New)
+		case isRow && hasHiddenField(fieldType, roles):
+			change.Old, change.New = trimSummary(change.Old), trimSummary(change.New)
+		}
+		list = append(list, change)
+	}
+	return list
+}
+
+// 按字段路径查找没有查看权限的字段 | 路径格式同FieldChange.Field
+//
+// 返回路径上第一个没有查看权限的字段权限和字段类型;都有权限时返回nil和路径指向的类型,isRow表示路径指向子表数据
+func lookupFieldPermission(t reflect.Type, path string, roles []string) (perm *fieldPermission, fieldType reflect.Type, isRow bool) {
+	for _, name := range strings.Split(path, ".") {
+		name, _, isRow = strings.Cut(name, "[")
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, t, false
+		}
+		field, ok := t.FieldByName(name)
+		if !ok {
+			return nil, t, false
+		}
+		if perm := parseFieldPermission(field.Tag); perm != nil && !perm.canView(roles) {
+			return perm, field.Type, false
+		}
+		t = field.Type
+	}
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return nil, t, isRow
+}
+
+// 是否有没有查看权限的字段 | 包含匿名嵌套结构体
+func hasHiddenField(t reflect.Type, roles []string) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && hasHiddenField(field.Type, roles) {
+			return true
+		}
+		if perm := parseFieldPermission(field.Tag); perm != nil && !perm.canView(roles) {
+			return true
+		}
+	}
+	return false
+}
+
+// 去掉摘要 | e.g. 新增(成本:10) -> 新增
+func trimSummary(value string) string {
+	if idx := strings.Index(value, "("); idx > 0 && strings.HasSuffix(value, ")") {
+		return value[:idx]
+	}
+	return value
+}
+
+// 不查询的字段 | 没有查看权限且不需要脱敏的表字段,开启WithoutPermission时为空
+func (b *BaseModel[T]) hiddenColumns() ([]string, error) {
+	if b.SkipPermission {
+		return nil, nil
+	}
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return nil, err
+	}
+	roles := b.currRoles()
+	columns := make([]string, 0)
+	for _, field := range modelSchema.Fields {
+		perm := parseFieldPermission(field.Tag)
+		if field.DBName == "" || perm == nil || perm.Mask != "" || perm.canView(roles) {
+			continue
+		}
+		columns = append(columns, field.DBName)
+	}
+	return columns, nil
+}
+
+// 校验游标分页的排序字段 | 没有查看权限的字段(包含脱敏字段)不能作为排序键,游标中会带出原值
+func (b *BaseModel[T]) checkCursorSort(search any) error {
+	if b.SkipPermission {
+		return nil
+	}
+	columns, err := db.CursorSortColumns(search)
+	if err != nil {
+		return err
+	}
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return err
+	}
+	roles := b.currRoles()
+	for _, column := range columns {
+		table, name, _ := strings.Cut(column, ".")
+		if table != b.TableName {
+			continue
+		}
+		field := modelSchema.LookUpField(name)
+		if field == nil {
+			continue
+		}
+		if perm := parseFieldPermission(field.Tag); perm != nil && !perm.canView(roles) {
+			return fmt.Errorf("[%s]没有字段[%s]的查看权限,不能按该字段游标分页", b.TableName, field.Name)
+		}
+	}
+	return nil
+}
+
+// 校验字段编辑权限 | 没有编辑权限的字段不允许修改,一对多子表按Id匹配递归校验,开启WithoutPermission时不校验
+func (b *BaseModel[T]) checkEditable(oldData, newData *T) error {
+	if b.SkipPermission {
+		return nil
+	}
+	if path := editedField("", reflect.ValueOf(oldData), reflect.ValueOf(newData), b.currRoles()); path != "" {
+		return fmt.Errorf("[%s]没有字段[%s]的编辑权限", b.TableName, path)
+	}
+	return nil
+}
+
+// 校验表字段的编辑权限 | 用于按表字段名批量更新,开启WithoutPermission时不校验
+func (b *BaseModel[T]) checkEditableColumns(columns []string) error {
+	if b.SkipPermission {
+		return nil
+	}
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return err
+	}
+	roles := b.currRoles()
+	for _, column := range columns {
+		field := modelSchema.LookUpField(column)
+		if field == nil {
+			continue
+		}
+		if perm := parseFieldPermission(field.Tag); perm != nil && !perm.canEdit(roles) {
+			return fmt.Errorf("[%s]没有字段[%s]的编辑权限", b.TableName, field.Name)
+		}
+	}
+	return nil
+}
+
+// 查找没有编辑权限但被修改的字段 | 返回字段路径,跳过gorm:"-"的字段
+//
+// 子表字段路径与DiffData一致 e.g. Items[1].Cost, Items[new#0].Cost;新增的子表数据有值即视为修改
+func editedField(path string, oldVal, newVal reflect.Value, roles []string) string {
+	oldVal, newVal = indirectValue(oldVal), indirectValue(newVal)
+	structType := validType(oldVal, newVal)
+	if structType == nil || structType.Kind() != reflect.Struct {
+		return ""
+	}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() || strings.HasPrefix(field.Tag.Get("gorm"), "-") {
+			continue
+		}
+		oldField, newField := structField(oldVal, i), structField(newVal, i)
+
+		// 匿名嵌套结构体 | 例如BaseModel
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if edited := editedField(path, oldField, newField, roles); edited != "" {
+				return edited
+			}
+			continue
+		}
+
+		// 没有编辑权限的字段
+		fieldPath := path + field.Name
+		if perm := parseFieldPermission(field.Tag); perm != nil && !perm.canEdit(roles) {
+			if valueChanged(oldField, newField) {
+				return fieldPath
+			}
+			continue
+		}
+
+		// 一对多子表
+		if isStructSlice(field.Type) {
+			if edited := editedChildren(fieldPath, oldField, newField, roles); edited != "" {
+				return edited
+			}
+		}
+	}
+	return ""
+}
+
+// 查找子表中被修改的字段 | 按Id匹配旧数据,删除子表数据不校验
+func editedChildren(path string, oldList, newList reflect.Value, roles []string) string {
+	if !newList.IsValid() {
+		return ""
+	}
+	oldMap := make(map[uint64]reflect.Value)
+	if oldList.IsValid() {
+		for i := 0; i < oldList.Len(); i++ {
+			item := indirectValue(oldList.Index(i))
+			if id := entityIdOf(item); id != 0 {
+				oldMap[id] = item
+			}
+		}
+	}
+	for i := 0; i < newList.Len(); i++ {
+		item := indirectValue(newList.Index(i))
+		if !item.IsValid() {
+			continue
+		}
+		id := entityIdOf(item)
+		itemPath := fmt.Sprintf("%s[%d].", path, id)
+		if id == 0 {
+			itemPath = fmt.Sprintf("%s[new#%d].", path, i)
+		}
+		if edited := editedField(itemPath, oldMap[id], item, roles); edited != "" {
+			return edited
+		}
+	}
+	return ""
+}
+
+// 字段值是否变化 | 一方无效时另一方非零值视为变化
+func valueChanged(oldVal, newVal reflect.Value) bool {
+	switch {
+	case !oldVal.IsValid() && !newVal.IsValid():
+		return false
+	case !oldVal.IsValid():
+		return !newVal.IsZero()
+	case !newVal.IsValid():
+		return !oldVal.IsZero()
+	}
+	return !reflect.DeepEqual(oldVal.Interface(), newVal.Interface())
+}
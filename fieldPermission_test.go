@@ -0,0 +1,243 @@
+package base
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type testCustomer struct {
+	BaseModel[testCustomer]
+	Name    string              `json:"name" comment:"客户名称"`
+	Phone   string              `json:"phone" perm:"view:admin;mask:phone" comment:"手机号"`
+	Address string              `json:"address" perm:"view:admin,sales;edit:admin" comment:"地址"`
+	Price   float64             `json:"price" perm:"view:admin" comment:"价格"`
+	Items   []*testCustomerItem `json:"items" gorm:"foreignKey:CustomerId" comment:"明细"`
+}
+
+func (m *testCustomer) TableName() string {
+	return "test_customer"
+}
+
+type testCustomerItem struct {
+	BaseModel[testCustomerItem]
+	CustomerId uint64  `json:"customerId" comment:"客户Id"`
+	Cost       float64 `json:"cost" perm:"view:admin" comment:"成本"`
+}
+
+func (m *testCustomerItem) TableName() string {
+	return "test_customer_item"
+}
+
+func newDryRunCustomer(t *testing.T, roles ...string) (*testCustomer, *[]string) {
+	db, sqls := newDryRunDb(t)
+	ctx := NewContext(context.Background(), "1", "张三")
+	SetIdentity(ctx, &Identity{UserId: "1", Roles: roles})
+	entity := &testCustomer{}
+	entity.BaseModel = NewBaseModelWithContext(ctx, db, entity.TableName(), entity)
+	return entity, sqls
+}
+
+func TestMaskString(t *testing.T) {
+	tests := []struct {
+		style, value, want string
+	}{
+		{MaskPhone, "13812345678", "138****5678"},
+		{MaskName, "张三丰", "张**"},
+		{MaskEmail, "zhangsan@example.com", "z***@example.com"},
+		{MaskAll, "北京市朝阳区", "******"},
+		{MaskPhone, "123", "******"},
+		{MaskName, "", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, maskString(tt.style, tt.value))
+	}
+}
+
+func TestMaskFields(t *testing.T) {
+	newData := func() *testCustomer {
+		return &testCustomer{Name: "张三", Phone: "13812345678", Address: "北京市朝阳区", Price: 99, Items: []*testCustomerItem{{Cost: 10}}}
+	}
+
+	// 没有查看权限时脱敏或清空,递归处理子表
+	customer, _ := newDryRunCustomer(t, "sales")
+	data := newData()
+	assert.Nil(t, customer.MaskFields([]*testCustomer{data}))
+	assert.Equal(t, "138****5678", data.Phone)
+	assert.Equal(t, "北京市朝阳区", data.Address)
+	assert.Equal(t, float64(0), data.Price)
+	assert.Equal(t, float64(0), data.Items[0].Cost)
+
+	// 有查看权限
+	customer, _ = newDryRunCustomer(t, "admin")
+	data = newData()
+	assert.Nil(t, customer.MaskFields(data))
+	assert.Equal(t, newData(), data)
+
+	// 必须是指针或切片
+	assert.NotNil(t, customer.MaskFields(*data))
+}
+
+func TestListHiddenColumns(t *testing.T) {
+	// 不查询没有查看权限且不需要脱敏的字段
+	customer, sqls := newDryRunCustomer(t)
+	_, _ = customer.List()
+	assert.NotContains(t, (*sqls)[0], "`address`")
+	assert.NotContains(t, (*sqls)[0], "`price`")
+	assert.Contains(t, (*sqls)[0], "`test_customer`.`phone`")
+
+	// 有查看权限时查询全部字段
+	customer, sqls = newDryRunCustomer(t, "admin")
+	_, _ = customer.List()
+	assert.Equal(t, "SELECT * FROM `test_customer` WHERE `test_customer`.`deleted_at` IS NULL ORDER BY id desc", (*sqls)[0])
+}
+
+func TestUpdateEditable(t *testing.T) {
+	type request struct {
+		Name    string
+		Address string
+	}
+	newOld := func() *testCustomer {
+		old := &testCustomer{Name: "张三", Address: "北京市朝阳区"}
+		old.Id = 1
+		return old
+	}
+
+	// 设置数据时不校验,更新时与旧数据对比校验
+	customer, sqls := newDryRunCustomer(t, "sales")
+	_, err := customer.SetData(&request{Name: "李四", Address: "北京市海淀区"})
+	assert.Nil(t, err)
+	data := newOld()
+	data.Address = "北京市海淀区"
+	err = customer.updateAggregate(customer.Db, data, newOld())
+	assert.EqualError(t, err, "[test_customer]没有字段[Address]的编辑权限")
+	assert.Empty(t, *sqls)
+
+	// 未修改时可以更新其他字段
+	data = newOld()
+	data.Name = "李四"
+	assert.Nil(t, customer.updateAggregate(customer.Db, data, newOld()))
+
+	// 部分更新同样校验
+	customer, sqls = newDryRunCustomer(t, "sales")
+	customer.BaseModel.Id, customer.Address = 1, "北京市朝阳区"
+	customer.takeSnapshot(customer)
+	customer.Address = "北京市海淀区"
+	_, err = customer.UpdateFields("Address")
+	assert.ErrorContains(t, err, "编辑权限")
+	assert.Empty(t, *sqls)
+
+	// 按业务编码更新时与已存在的数据对比
+	_ = customer.Db.Callback().Query().After("gorm:query").Register("test:olds", func(tx *gorm.DB) {
+		if olds, ok := tx.Statement.Dest.(*[]*testCustomer); ok {
+			*olds = []*testCustomer{newOld()}
+		}
+	})
+	_, err = customer.UpsertByBusinessCode("name", &testCustomer{Name: "张三", Address: "北京市海淀区"})
+	assert.ErrorContains(t, err, "编辑权限")
+
+	// 按条件批量更新时校验字段
+	_, err = customer.UpdateWhere(func(db *gorm.DB) *gorm.DB { return db }, map[string]any{"address": "北京市海淀区"})
+	assert.EqualError(t, err, "[test_customer]没有字段[Address]的编辑权限")
+
+	// 有编辑权限
+	customer, _ = newDryRunCustomer(t, "admin")
+	data = newOld()
+	data.Address = "北京市海淀区"
+	assert.Nil(t, customer.updateAggregate(customer.Db, data, newOld()))
+}
+
+func TestCheckEditableChildren(t *testing.T) {
+	customer, _ := newDryRunCustomer(t, "sales")
+	oldData := &testCustomer{Items: []*testCustomerItem{{BaseModel: BaseModel[testCustomerItem]{Id: 1}, Cost: 10}}}
+
+	// 子表按Id匹配校验
+	newData := &testCustomer{Items: []*testCustomerItem{{BaseModel: BaseModel[testCustomerItem]{Id: 1}, Cost: 20}}}
+	err := customer.checkEditable(oldData, newData)
+	assert.EqualError(t, err, "[test_customer]没有字段[Items[1].Cost]的编辑权限")
+
+	// 新增的子表数据有值即视为修改
+	newData = &testCustomer{Items: []*testCustomerItem{{BaseModel: BaseModel[testCustomerItem]{Id: 1}, Cost: 10}, {Cost: 5}}}
+	err = customer.checkEditable(oldData, newData)
+	assert.EqualError(t, err, "[test_customer]没有字段[Items[new#1].Cost]的编辑权限")
+
+	// 未修改或删除子表数据
+	newData = &testCustomer{Items: []*testCustomerItem{{CustomerId: 1}}}
+	assert.Nil(t, customer.checkEditable(oldData, newData))
+
+	// 有编辑权限
+	customer, _ = newDryRunCustomer(t, "admin")
+	newData = &testCustomer{Items: []*testCustomerItem{{BaseModel: BaseModel[testCustomerItem]{Id: 1}, Cost: 20}}}
+	assert.Nil(t, customer.checkEditable(oldData, newData))
+}
+
+func TestMaskChanges(t *testing.T) {
+	changes := []FieldChange{
+		{Field: "Name", Label: "客户名称", Old: "张三", New: "李四"},
+		{Field: "Phone", Label: "手机号", Old: "13812345678", New: "13912345678"},
+		{Field: "Price", Label: "价格", Old: "1", New: "2"},
+		{Field: "Items[1].Cost", Label: "明细[1].成本", Old: "1", New: "2"},
+		{Field: "Items[new#0]", Label: "明细", New: "新增(成本:5)"},
+	}
+
+	// 没有查看权限的字段脱敏或去掉,子表新增只保留操作
+	customer, _ := newDryRunCustomer(t, "sales")
+	assert.Equal(t, []FieldChange{
+		{Field: "Name", Label: "客户名称", Old: "张三", New: "李四"},
+		{Field: "Phone", Label: "手机号", Old: "138****5678", New: "139****5678"},
+		{Field: "Items[new#0]", Label: "明细", New: "新增"},
+	}, customer.maskChanges(changes))
+
+	// 有查看权限
+	customer, _ = newDryRunCustomer(t, "admin")
+	assert.Equal(t, changes, customer.maskChanges(changes))
+}
+
+func TestEachUnmasked(t *testing.T) {
+	customer, sqls := newDryRunCustomer(t, "sales")
+	_ = customer.Db.Callback().Query().After("gorm:query").Register("test:rows", func(tx *gorm.DB) {
+		if list, ok := tx.Statement.Dest.(*[]*testCustomer); ok {
+			*list = []*testCustomer{{Phone: "13812345678", Items: []*testCustomerItem{{Cost: 10}}}}
+		}
+	})
+
+	// 读取完整数据,不按字段权限隐藏或脱敏
+	batches := 0
+	err := customer.Each(10, func(batch []*testCustomer) error {
+		batches++
+		assert.Equal(t, "13812345678", batch[0].Phone)
+		assert.Equal(t, float64(10), batch[0].Items[0].Cost)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, batches)
+	assert.True(t, strings.HasPrefix((*sqls)[0], "SELECT * FROM `test_customer`"))
+}
+
+func TestCursorSortPermission(t *testing.T) {
+	type search struct {
+		Cursor    string `search:"cursor"`
+		PageSize  int64  `search:"pageSize"`
+		NameSort  string `search:"type:order;column:name;table:test_customer"`
+		PhoneSort string `search:"type:order;column:phone;table:test_customer"`
+		PriceSort string `search:"type:order;column:price;table:test_customer"`
+	}
+
+	// 没有查看权限的字段(包含脱敏字段)不能作为排序键
+	customer, sqls := newDryRunCustomer(t, "sales")
+	_, err := customer.ListPage(search{PageSize: 10, PriceSort: "desc"})
+	assert.NotNil(t, err)
+	_, err = customer.ListPage(search{PageSize: 10, PhoneSort: "desc"})
+	assert.NotNil(t, err)
+	assert.Empty(t, *sqls)
+
+	// 有查看权限的字段
+	_, err = customer.ListPage(search{PageSize: 10, NameSort: "desc"})
+	assert.Nil(t, err)
+	customer, _ = newDryRunCustomer(t, "admin")
+	_, err = customer.ListPage(search{PageSize: 10, PriceSort: "desc"})
+	assert.Nil(t, err)
+}
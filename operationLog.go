@@ -0,0 +1,185 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/jianyuezhexue/base/db"
+)
+
+// 操作日志
+type OperationLog struct {
+	Id            uint64       `json:"id" gorm:"primarykey"`                         // 主键
+	Table         string       `json:"table" gorm:"column:table_name"`               // 业务表名
+	EntityId      uint64       `json:"entityId" gorm:"column:entity_id"`             // 业务数据Id
+	OperatorId    string       `json:"operatorId" gorm:"column:operator_id"`         // 操作人id
+	OperatorName  string       `json:"operatorName" gorm:"column:operator_name"`     // 操作人名称
+	OperationType string       `json:"operationType" gorm:"column:operation_type"`   // 操作类型 | create,update,delete,事件名称
+	OperationName string       `json:"operationName" gorm:"column:operation_name"`   // 操作类型名称 | 新增,更新,删除,事件中文名称
+	OldData       string       `json:"oldData" gorm:"column:old_data;type:text"`     // 旧数据快照(JSON)
+	NewData       string       `json:"newData" gorm:"column:new_data;type:text"`     // 新数据快照(JSON)
+	Changes       string       `json:"changes" gorm:"column:changes;type:text"`      // 字段变更(JSON) | []FieldChange
+	CreatedAt     db.LocalTime `json:"createdAt" gorm:"column:created_at;<-:create"` // 操作时间
+}
+
+// 数据表名
+func (m *OperationLog) TableName() string {
+	return "operation_log"
+}
+
+// 默认操作日志实现 | 写入operation_log表,和业务数据使用同一个事务
+func (b *BaseModel[T]) SaveOperationLog(operatorType, operatorTypeName string, oldData, newData any) error {
+	if b.OperatorId == "" {
+		return fmt.Errorf("Ctx中[currUserId]不存在,无法记录操作日志,请开发检查")
+	}
+	oldJson, err := snapshotJson(oldData)
+	if err != nil {
+		return err
+	}
+	newJson, err := snapshotJson(newData)
+	if err != nil {
+		return err
+	}
+
+	// 新旧数据都已落库时计算字段变更
+	changesJson := ""
+	if entityId(oldData) != 0 && entityId(newData) != 0 {
+		if changes := DiffData(oldData, newData); len(changes) > 0 {
+			bytes, err := json.Marshal(changes)
+			if err != nil {
+				return err
+			}
+			changesJson = string(bytes)
+		}
+	}
+
+	// 组合日志数据 | 删除场景新数据为空,取旧数据的Id和表名
+	log := &OperationLog{
+		Table:         b.TableName,
+		EntityId:      entityId(newData),
+		OperatorId:    b.OperatorId,
+		OperatorName:  b.OperatorName,
+		OperationType: operatorType,
+		OperationName: operatorTypeName,
+		OldData:       oldJson,
+		NewData:       newJson,
+		Changes:       changesJson,
+	}
+	if log.EntityId == 0 {
+		log.EntityId = entityId(oldData)
+	}
+	if tableName := entityTableName(newData, oldData); tableName != "" {
+		log.Table = tableName
+	}
+
+	return b.Tx().Create(log).Error
+}
+
+// 读取业务实体Id | 非实体或未落库返回0
+func entityId(data any) uint64 {
+	if data == nil {
+		return 0
+	}
+	return entityIdOf(indirectValue(reflect.ValueOf(data)))
+}
+
+// 读取业务实体表名 | 按顺序取第一个实现了TableName()的数据
+func entityTableName(datas ...any) string {
+	for _, data := range datas {
+		if data == nil || reflect.ValueOf(data).Kind() == reflect.Ptr && reflect.ValueOf(data).IsNil() {
+			continue
+		}
+		if tabler, ok := data.(interface{ TableName() string }); ok {
+			return tabler.TableName()
+		}
+	}
+	return ""
+}
+
+// 数据快照 | 空数据或未落库的空实体返回空字符串
+func snapshotJson(data any) (string, error) {
+	if data == nil {
+		return "", nil
+	}
+	val := reflect.ValueOf(data)
+	if val.Kind() == reflect.Ptr && val.IsNil() {
+		return "", nil
+	}
+	if val.Kind() == reflect.Ptr && reflect.Indirect(val).Kind() == reflect.Struct && entityId(data) == 0 && reflect.Indirect(val).IsZero() {
+		return "", nil
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// 操作记录
+type HistoryItem struct {
+	Id            uint64        `json:"id"`            // 日志Id
+	Type          string        `json:"type"`          // 记录类型 | create,update,event,delete
+	OperationType string        `json:"operationType"` // 操作类型 | 事件记录为事件名称
+	OperationName string        `json:"operationName"` // 操作名称
+	OperatorId    string        `json:"operatorId"`    // 操作人id
+	OperatorName  string        `json:"operatorName"`  // 操作人名称
+	OperatedAt    db.LocalTime  `json:"operatedAt"`    // 操作时间
+	Changes       []FieldChange `json:"changes"`       // 字段变更
+}
+
+// 查询操作记录 | 按操作顺序排列,读取默认的operation_log表
+//
+// 数据需要在当前用户的数据范围内(包含已删除的数据),已彻底删除的数据无法查询;没有查看权限的字段变更脱敏或不返回
+func (b *BaseModel[T]) History(id uint64) ([]*HistoryItem, error) {
+	// 校验数据范围
+	var count int64
+	err := b.readDb().Unscoped().Model(new(T)).
+		Where(fmt.Sprintf("`%s`.`id` = ?", b.TableName), id).
+		Scopes(b.dataScope). // 数据范围
+		Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("[%s]数据[%d]不存在或无权限,请检查", b.TableName, id)
+	}
+
+	logs := make([]*OperationLog, 0)
+	err = b.readDb().Where("table_name = ? and entity_id = ?", b.TableName, id).Order("id asc").Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// 组合操作记录
+	list := make([]*HistoryItem, 0, len(logs))
+	for _, log := range logs {
+		item := &HistoryItem{
+			Id:            log.Id,
+			Type:          historyType(log.OperationType),
+			OperationType: log.OperationType,
+			OperationName: log.OperationName,
+			OperatorId:    log.OperatorId,
+			OperatorName:  log.OperatorName,
+			OperatedAt:    log.CreatedAt,
+			Changes:       make([]FieldChange, 0),
+		}
+		if log.Changes != "" {
+			if err := json.Unmarshal([]byte(log.Changes), &item.Changes); err != nil {
+				return nil, err
+			}
+			item.Changes = b.maskChanges(item.Changes)
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// 操作记录类型 | 新增,更新,删除以外的操作都是事件
+func historyType(operationType string) string {
+	switch operationType {
+	case LogTypeCreate, LogTypeUpdate, LogTypeDelete, LogTypeRestore, LogTypePurge:
+		return operationType
+	}
+	return LogTypeEvent
+}
@@ -0,0 +1,120 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 乐观锁冲突 | 使用 errors.Is(err, ErrVersionConflict) 判断
+var ErrVersionConflict = errors.New("数据已被修改,请刷新后重试")
+
+// 乐观锁冲突错误
+type VersionConflictError struct {
+	TableName string // 表名
+	Id        uint64 // 数据Id
+	Version   int64  // 提交时的版本号
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("[%s]数据[%d]版本[%d]已被修改,请刷新后重试", e.TableName, e.Id, e.Version)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// 查询版本号字段 | 实体字段标记 lock:"version" 开启乐观锁,未标记返回nil
+func (b *BaseModel[T]) versionField() (*schema.Field, error) {
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range modelSchema.Fields {
+		if field.Tag.Get("lock") == "version" && field.DBName != "" {
+			return field, nil
+		}
+	}
+	return nil, nil
+}
+
+// 保存数据 | 开启乐观锁时,更新条件带上旧版本号并递增版本号,影响行数为0视为冲突
+func (b *BaseModel[T]) saveWithVersion(db *gorm.DB, data *T) error {
+	field, err := b.versionField()
+	if err != nil {
+		return err
+	}
+
+	// 未开启乐观锁 | 新数据直接保存
+	if field == nil || entityId(data) == 0 {
+		return db.Save(data).Error
+	}
+
+	// 读取旧版本号并递增
+	ctx := db.Statement.Context
+	reflectValue := reflect.ValueOf(data).Elem()
+	value, _ := field.ValueOf(ctx, reflectValue)
+	oldVersion := reflect.ValueOf(value).Convert(reflect.TypeOf(int64(0))).Int()
+	if err := field.Set(ctx, reflectValue, oldVersion+1); err != nil {
+		return err
+	}
+
+	// 带版本号条件更新 | Select("*")避免影响行数为0时Save降级为插入
+	versionCond := clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: oldVersion}
+	res := db.Select("*").Where(versionCond).Save(data)
+	if res.Error != nil || res.RowsAffected == 0 {
+		_ = field.Set(ctx, reflectValue, oldVersion)
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return &VersionConflictError{TableName: b.TableName, Id: entityId(data), Version: oldVersion}
+	}
+	return nil
+}
+
+// 按字段更新数据 | 同时更新更新人信息;开启乐观锁时,更新条件带上旧版本号并递增版本号,影响行数为0视为冲突
+func (b *BaseModel[T]) updateWithVersion(db *gorm.DB, data *T, columns []string) error {
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return err
+	}
+	field, err := b.versionField()
+	if err != nil {
+		return err
+	}
+
+	// 未开启乐观锁
+	if field == nil {
+		return updateColumns(db, modelSchema, data, columns).Error
+	}
+
+	// 读取旧版本号并递增
+	ctx := db.Statement.Context
+	reflectValue := reflect.ValueOf(data).Elem()
+	value, _ := field.ValueOf(ctx, reflectValue)
+	oldVersion := reflect.ValueOf(value).Convert(reflect.TypeOf(int64(0))).Int()
+	if err := field.Set(ctx, reflectValue, oldVersion+1); err != nil {
+		return err
+	}
+
+	// 带版本号条件更新
+	versionCond := clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: oldVersion}
+	res := updateColumns(db.Where(versionCond), modelSchema, data, append(slices.Clone(columns), field.DBName))
+	if res.Error != nil || res.RowsAffected == 0 {
+		_ = field.Set(ctx, reflectValue, oldVersion)
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return &VersionConflictError{TableName: b.TableName, Id: entityId(data), Version: oldVersion}
+	}
+	return nil
+}
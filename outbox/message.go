@@ -0,0 +1,32 @@
+package outbox
+
+import (
+	"github.com/jianyuezhexue/base/db"
+)
+
+// 消息状态
+const (
+	StatusPending   = 0 // 待发送
+	StatusDelivered = 1 // 已发送
+	StatusFailed    = 2 // 发送失败 | 超过最大重试次数,需要人工处理
+)
+
+// 发件箱消息 | 领域事件和业务数据在同一个事务中写入
+type Message struct {
+	Id            uint64       `json:"id" gorm:"primarykey"`                         // 主键
+	Topic         string       `json:"topic" gorm:"column:topic"`                    // 事件名称 | e.g. OrderConfirmed
+	AggregateType string       `json:"aggregateType" gorm:"column:aggregate_type"`   // 聚合类型 | 业务表名
+	AggregateId   uint64       `json:"aggregateId" gorm:"column:aggregate_id"`       // 聚合Id | 业务数据Id
+	Payload       string       `json:"payload" gorm:"column:payload;type:text"`      // 事件内容(JSON)
+	Status        int          `json:"status" gorm:"column:status"`                  // 状态 | 0待发送 1已发送 2发送失败
+	Attempts      int          `json:"attempts" gorm:"column:attempts"`              // 已尝试次数
+	LastError     string       `json:"lastError" gorm:"column:last_error"`           // 最近一次失败原因
+	NextRetryAt   db.LocalTime `json:"nextRetryAt" gorm:"column:next_retry_at"`      // 下次重试时间
+	DeliveredAt   db.LocalTime `json:"deliveredAt" gorm:"column:delivered_at"`       // 发送时间
+	CreatedAt     db.LocalTime `json:"createdAt" gorm:"column:created_at;<-:create"` // 创建时间
+}
+
+// 数据表名
+func (m *Message) TableName() string {
+	return "outbox"
+}
@@ -0,0 +1,54 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+)
+
+// 消息发布接口 | 对接MQ等外部系统
+type Publisher interface {
+	Publish(ctx context.Context, msg *Message) error
+}
+
+// 内存消息发布 | 测试使用
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []*Message
+	FailFunc func(msg *Message) error // 模拟发送失败,返回非nil即失败
+}
+
+// 实例化内存消息发布
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{messages: make([]*Message, 0)}
+}
+
+// 发布消息
+func (p *MemoryPublisher) Publish(_ context.Context, msg *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.FailFunc != nil {
+		if err := p.FailFunc(msg); err != nil {
+			return err
+		}
+	}
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+// 已发布的消息 | 按发布顺序
+func (p *MemoryPublisher) Messages() []*Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	list := make([]*Message, len(p.messages))
+	copy(list, p.messages)
+	return list
+}
+
+// 清空已发布的消息
+func (p *MemoryPublisher) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = make([]*Message, 0)
+}
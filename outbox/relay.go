@@ -0,0 +1,184 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jianyuezhexue/base/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 消息中继 | 按顺序读取待发送消息,交给Publisher发布,失败按退避策略重试
+//
+// 投递语义为至少一次: 发布成功但标记失败时,消息会被再次发布,消费方需要幂等
+type Relay struct {
+	db          *gorm.DB                         // 数据库连接
+	publisher   Publisher                        // 消息发布
+	batchSize   int                              // 每批处理条数
+	maxAttempts int                              // 最大尝试次数
+	interval    time.Duration                    // 轮询间隔
+	backoff     func(attempts int) time.Duration // 重试退避策略
+	onError     func(err error)                  // 轮询异常处理
+}
+
+// ---------- OPTIONS函数 ----------
+type RelayOption func(*Relay)
+
+// 每批处理条数
+func WithBatchSize(batchSize int) RelayOption {
+	return func(r *Relay) {
+		r.batchSize = batchSize
+	}
+}
+
+// 最大尝试次数 | 超过后标记为发送失败
+func WithMaxAttempts(maxAttempts int) RelayOption {
+	return func(r *Relay) {
+		r.maxAttempts = maxAttempts
+	}
+}
+
+// 轮询间隔
+func WithInterval(interval time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.interval = interval
+	}
+}
+
+// 重试退避策略
+func WithBackoff(backoff func(attempts int) time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.backoff = backoff
+	}
+}
+
+// 轮询异常处理 | 默认忽略,下个周期继续
+func WithErrorHandler(onError func(err error)) RelayOption {
+	return func(r *Relay) {
+		r.onError = onError
+	}
+}
+
+// 实例化消息中继
+func NewRelay(db *gorm.DB, publisher Publisher, opts ...RelayOption) *Relay {
+	relay := &Relay{
+		db:          db,
+		publisher:   publisher,
+		batchSize:   100,
+		maxAttempts: 10,
+		interval:    time.Second,
+		backoff:     ExponentialBackoff(time.Second, 10*time.Minute),
+	}
+	for _, fc := range opts {
+		fc(relay)
+	}
+	return relay
+}
+
+// 指数退避 | base * 2^(attempts-1),不超过max
+func ExponentialBackoff(base, max time.Duration) func(attempts int) time.Duration {
+	return func(attempts int) time.Duration {
+		if attempts <= 0 {
+			return base
+		}
+		delay := base
+		for i := 1; i < attempts; i++ {
+			delay *= 2
+			if delay >= max {
+				return max
+			}
+		}
+		if delay > max {
+			return max
+		}
+		return delay
+	}
+}
+
+// 持续轮询 | ctx取消后退出
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RelayOnce(ctx); err != nil && r.onError != nil {
+			r.onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// 处理一批消息 | 返回发布成功的条数
+//
+// 同一聚合的消息按Id顺序发布: 前面的消息未发送成功时,后面的消息不会被读取
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	delivered := 0
+	tableName := (&Message{}).TableName()
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 读取待发送消息 | 多实例部署时跳过其他实例锁定的消息
+		now := time.Now()
+		list := make([]*Message, 0)
+		err := tx.Table(tableName).
+			Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+			Where("status = ?", StatusPending).
+			Where("next_retry_at is null or next_retry_at <= ?", now).
+			Where(fmt.Sprintf("not exists (select 1 from `%s` as prev where prev.aggregate_type = `%s`.aggregate_type and prev.aggregate_id = `%s`.aggregate_id and prev.status = ? and prev.id < `%s`.id)",
+				tableName, tableName, tableName, tableName), StatusPending).
+			Order("id asc").
+			Limit(r.batchSize).
+			Find(&list).Error
+		if err != nil {
+			return err
+		}
+
+		// 逐条发布 | 同一聚合前面的消息失败后,本批次跳过该聚合后续消息
+		failed := make(map[string]struct{})
+		for _, msg := range list {
+			key := fmt.Sprintf("%s:%d", msg.AggregateType, msg.AggregateId)
+			if _, ok := failed[key]; ok {
+				continue
+			}
+
+			msg.Attempts++
+			if err := r.publisher.Publish(ctx, msg); err != nil {
+				failed[key] = struct{}{}
+				updates := map[string]any{"attempts": msg.Attempts, "last_error": truncate(err.Error(), 500)}
+				if msg.Attempts >= r.maxAttempts {
+					updates["status"] = StatusFailed
+				} else {
+					updates["next_retry_at"] = db.LocalTime(now.Add(r.backoff(msg.Attempts)))
+				}
+				if err := tx.Model(msg).Updates(updates).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			// 标记已发送
+			updates := map[string]any{"attempts": msg.Attempts, "status": StatusDelivered, "delivered_at": db.LocalTime(time.Now())}
+			if err := tx.Model(msg).Updates(updates).Error; err != nil {
+				return err
+			}
+			delivered++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return delivered, nil
+}
+
+// 截断字符串
+func truncate(str string, size int) string {
+	runes := []rune(str)
+	if len(runes) <= size {
+		return str
+	}
+	return string(runes[:size])
+}
@@ -0,0 +1,184 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jianyuezhexue/base/db"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// DryRun连接池 | 支持开启事务,不连接数据库
+type dryRunPool struct{}
+
+func (p *dryRunPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errors.New("dry run")
+}
+func (p *dryRunPool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return nil, errors.New("dry run")
+}
+func (p *dryRunPool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return nil, errors.New("dry run")
+}
+func (p *dryRunPool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return nil
+}
+func (p *dryRunPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return &dryRunTx{dryRunPool: p}, nil
+}
+
+// DryRun事务
+type dryRunTx struct {
+	*dryRunPool
+}
+
+func (tx *dryRunTx) Commit() error   { return nil }
+func (tx *dryRunTx) Rollback() error { return nil }
+
+// 消息更新
+type messageUpdate struct {
+	Id      uint64
+	Updates map[string]any
+}
+
+// DryRun消息中继 | 查询返回pending中的消息,返回查询SQL和消息更新
+func newDryRunRelay(t *testing.T, publisher Publisher, pending []*Message, opts ...RelayOption) (*Relay, *string, *[]messageUpdate) {
+	gormDb, err := gorm.Open(mysql.New(mysql.Config{Conn: &dryRunPool{}, SkipInitializeWithVersion: true}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	querySQL := ""
+	updates := make([]messageUpdate, 0)
+	_ = gormDb.Callback().Query().After("gorm:query").Register("test:pending", func(tx *gorm.DB) {
+		querySQL = tx.Statement.SQL.String()
+		if list, ok := tx.Statement.Dest.(*[]*Message); ok {
+			*list = pending
+		}
+	})
+	_ = gormDb.Callback().Update().After("gorm:update").Register("test:update", func(tx *gorm.DB) {
+		if msg, ok := tx.Statement.Model.(*Message); ok {
+			updates = append(updates, messageUpdate{Id: msg.Id, Updates: tx.Statement.Dest.(map[string]any)})
+		}
+	})
+	return NewRelay(gormDb, publisher, opts...), &querySQL, &updates
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(time.Second, time.Minute)
+	assert.Equal(t, time.Second, backoff(1))
+	assert.Equal(t, 2*time.Second, backoff(2))
+	assert.Equal(t, 8*time.Second, backoff(4))
+	assert.Equal(t, time.Minute, backoff(10))
+	assert.Equal(t, time.Minute, backoff(100))
+}
+
+func TestMemoryPublisher(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	publisher.FailFunc = func(msg *Message) error {
+		if msg.Topic == "Fail" {
+			return errors.New("模拟发送失败")
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	assert.Nil(t, publisher.Publish(ctx, &Message{Id: 1, Topic: "OrderConfirmed"}))
+	assert.NotNil(t, publisher.Publish(ctx, &Message{Id: 2, Topic: "Fail"}))
+	assert.Nil(t, publisher.Publish(ctx, &Message{Id: 3, Topic: "OrderDelivered"}))
+
+	messages := publisher.Messages()
+	assert.Len(t, messages, 2)
+	assert.Equal(t, uint64(1), messages[0].Id)
+	assert.Equal(t, uint64(3), messages[1].Id)
+
+	publisher.Reset()
+	assert.Empty(t, publisher.Messages())
+}
+
+func TestRelayOnceOrdering(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	publisher.FailFunc = func(msg *Message) error {
+		if msg.Id == 1 {
+			return errors.New("模拟发送失败")
+		}
+		return nil
+	}
+	pending := []*Message{
+		{Id: 1, AggregateType: "sales_order", AggregateId: 10},
+		{Id: 2, AggregateType: "sales_order", AggregateId: 10},
+		{Id: 3, AggregateType: "sales_order", AggregateId: 20},
+	}
+	relay, querySQL, _ := newDryRunRelay(t, publisher, pending)
+
+	// 同一聚合前面的消息失败后,跳过该聚合后续消息,其他聚合不受影响
+	delivered, err := relay.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+	messages := publisher.Messages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, uint64(3), messages[0].Id)
+
+	// 只读取到期的待发送消息,同一聚合有更早的待发送消息时不读取,按Id顺序读取
+	assert.Contains(t, *querySQL, "status = ? AND (next_retry_at is null or next_retry_at <= ?)")
+	assert.Contains(t, *querySQL, "prev.aggregate_id = `outbox`.aggregate_id and prev.status = ? and prev.id < `outbox`.id")
+	assert.True(t, strings.HasSuffix(*querySQL, "ORDER BY id asc LIMIT ? FOR UPDATE SKIP LOCKED"))
+}
+
+func TestRelayOnceDelivered(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	relay, _, updates := newDryRunRelay(t, publisher, []*Message{{Id: 1, Attempts: 2}})
+
+	// 发布成功后标记已发送
+	delivered, err := relay.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Len(t, *updates, 1)
+	update := (*updates)[0]
+	assert.Equal(t, uint64(1), update.Id)
+	assert.Equal(t, StatusDelivered, update.Updates["status"])
+	assert.Equal(t, 3, update.Updates["attempts"])
+	assert.NotZero(t, update.Updates["delivered_at"])
+}
+
+func TestRelayOnceRetry(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	publisher.FailFunc = func(msg *Message) error {
+		return errors.New("模拟发送失败")
+	}
+	pending := []*Message{
+		{Id: 1, AggregateType: "sales_order", AggregateId: 10, Attempts: 1},
+		{Id: 2, AggregateType: "sales_order", AggregateId: 20, Attempts: 2},
+	}
+	relay, _, updates := newDryRunRelay(t, publisher, pending, WithMaxAttempts(3), WithBackoff(func(attempts int) time.Duration {
+		return time.Duration(attempts) * time.Minute
+	}))
+
+	// 未超过最大次数时按退避策略设置下次重试时间,超过后标记为发送失败
+	start := time.Now()
+	delivered, err := relay.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, delivered)
+	assert.Len(t, *updates, 2)
+
+	retry := (*updates)[0].Updates
+	assert.Equal(t, 2, retry["attempts"])
+	assert.Equal(t, "模拟发送失败", retry["last_error"])
+	assert.Nil(t, retry["status"])
+	nextRetryAt := time.Time(retry["next_retry_at"].(db.LocalTime))
+	assert.WithinDuration(t, start.Add(2*time.Minute), nextRetryAt, time.Second)
+
+	failed := (*updates)[1].Updates
+	assert.Equal(t, 3, failed["attempts"])
+	assert.Equal(t, StatusFailed, failed["status"])
+	assert.Nil(t, failed["next_retry_at"])
+}
@@ -0,0 +1,128 @@
+package base
+
+import (
+	"sync"
+
+	"github.com/jianyuezhexue/base/db"
+)
+
+// 分页查询结果
+type PageResult[T any] struct {
+	Page       int64  `json:"page" comment:"页数"`
+	PageSize   int64  `json:"pageSize" comment:"每页数量"`
+	Total      int64  `json:"total" comment:"总条数"`
+	HasNext    bool   `json:"hasNext" comment:"是否有下一页"`
+	NextCursor string `json:"nextCursor,omitempty" comment:"下一页游标"`
+	List       []*T   `json:"list" comment:"数据"`
+}
+
+// 分页查询 | 读取search:"page"和search:"pageSize"标签,统计总数、查询列表,完善每条数据并按字段权限脱敏
+//
+// search不能是指针; 开启WithConcurrentPage时统计和列表并发查询,事务中始终顺序执行
+//
+// 游标分页(search:"cursor")不统计总数,返回下一页游标
+func (b *BaseModel[T]) ListPage(search any) (*PageResult[T], error) {
+	cond := b.MakeConditon(search)
+	page, pageSize := db.ResolvePage(search)
+	if db.IsCursorMode(search) {
+		return b.listCursorPage(search, cond, pageSize)
+	}
+
+	// 统计总数和查询列表
+	var total int64
+	var list []*T
+	var countErr, listErr error
+	if b.ConcurrentPage && !b.IsInTransaction() {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			total, countErr = b.Count(cond)
+		}()
+		go func() {
+			defer wg.Done()
+			list, listErr = b.List(cond)
+		}()
+		wg.Wait()
+	} else {
+		total, countErr = b.Count(cond)
+		if countErr == nil {
+			list, listErr = b.List(cond)
+		}
+	}
+	if countErr != nil {
+		return nil, countErr
+	}
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	// 完善数据
+	if err := completeList(list); err != nil {
+		return nil, err
+	}
+
+	// 字段脱敏
+	if err := b.MaskFields(list); err != nil {
+		return nil, err
+	}
+
+	// 组合返回数据
+	result := &PageResult[T]{
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		List:     list,
+	}
+	if pageSize > 0 {
+		result.HasNext = page*pageSize < total
+	}
+	return result, nil
+}
+
+// 游标分页查询 | 不允许按没有查看权限的字段排序
+func (b *BaseModel[T]) listCursorPage(search any, cond SearchCondition, pageSize int64) (*PageResult[T], error) {
+	if err := b.checkCursorSort(search); err != nil {
+		return nil, err
+	}
+	list, err := b.List(cond)
+	if err != nil {
+		return nil, err
+	}
+
+	// 完善数据
+	if err := completeList(list); err != nil {
+		return nil, err
+	}
+
+	// 组合返回数据 | 本页满页时认为有下一页
+	result := &PageResult[T]{
+		PageSize: pageSize,
+		List:     list,
+	}
+	if pageSize > 0 && int64(len(list)) == pageSize {
+		result.HasNext = true
+		result.NextCursor, err = db.NextCursor(search, list[len(list)-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 字段脱敏
+	if err := b.MaskFields(list); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 完善数据 | 调用业务实体的Complete
+func completeList[T any](list []*T) error {
+	for _, item := range list {
+		if completer, ok := any(item).(interface{ Complete() error }); ok {
+			if err := completer.Complete(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
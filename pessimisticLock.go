@@ -0,0 +1,85 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 行锁模式
+type LockMode int
+
+const (
+	LockForUpdate           LockMode = iota // FOR UPDATE
+	LockForUpdateNoWait                     // FOR UPDATE NOWAIT | 被锁时立即报错
+	LockForUpdateSkipLocked                 // FOR UPDATE SKIP LOCKED | 跳过被锁的行
+	LockForShare                            // FOR SHARE
+	LockForShareNoWait                      // FOR SHARE NOWAIT
+	LockForShareSkipLocked                  // FOR SHARE SKIP LOCKED
+)
+
+// 转换为gorm锁子句
+func (m LockMode) clause() clause.Locking {
+	switch m {
+	case LockForUpdateNoWait:
+		return clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsNoWait}
+	case LockForUpdateSkipLocked:
+		return clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}
+	case LockForShare:
+		return clause.Locking{Strength: clause.LockingStrengthShare}
+	case LockForShareNoWait:
+		return clause.Locking{Strength: clause.LockingStrengthShare, Options: clause.LockingOptionsNoWait}
+	case LockForShareSkipLocked:
+		return clause.Locking{Strength: clause.LockingStrengthShare, Options: clause.LockingOptionsSkipLocked}
+	default:
+		return clause.Locking{Strength: clause.LockingStrengthUpdate}
+	}
+}
+
+// 加锁加载数据 | 必须在事务中调用,使用事务Db
+func (b *BaseModel[T]) LoadDataWithLock(cond SearchCondition, mode LockMode, preloads ...PreloadsType) (*T, error) {
+	// 前置校验
+	if !b.IsInTransaction() {
+		return nil, fmt.Errorf("[%s]加锁查询必须在事务中执行,请开发检查", b.TableName)
+	}
+
+	// 读取业务实体 | 校验是否为空
+	entity, err := b.GetCurrEntity()
+	if err != nil {
+		return nil, fmt.Errorf("[BASE]中业务实体为空,请开发检查")
+	}
+
+	// 查询数据
+	db := withPreloads(b.Tx(), preloads...)
+	err = db.Clauses(mode.clause()).Scopes(b.dataScope).Scopes(cond).First(entity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("[%s]查询的数据不存在,请检查", b.TableName)
+		}
+		return nil, err
+	}
+
+	// 记录快照
+	b.takeSnapshot(entity)
+	return entity, nil
+}
+
+// 加锁加载数据 | SELECT ... FOR UPDATE
+func (b *BaseModel[T]) LoadDataForUpdate(cond SearchCondition, preloads ...PreloadsType) (*T, error) {
+	return b.LoadDataWithLock(cond, LockForUpdate, preloads...)
+}
+
+// 根据Id加锁加载数据
+func (b *BaseModel[T]) LoadByIdWithLock(id uint64, mode LockMode, preloads ...PreloadsType) (*T, error) {
+	cond := func(db *gorm.DB) *gorm.DB {
+		return db.Where("id = ?", id)
+	}
+	return b.LoadDataWithLock(cond, mode, preloads...)
+}
+
+// 根据Id加锁加载数据 | SELECT ... FOR UPDATE
+func (b *BaseModel[T]) LoadByIdForUpdate(id uint64, preloads ...PreloadsType) (*T, error) {
+	return b.LoadByIdWithLock(id, LockForUpdate, preloads...)
+}
@@ -0,0 +1,160 @@
+package base
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 数据范围
+type DataScope string
+
+const (
+	DataScopeAll        DataScope = "all"         // 全部数据
+	DataScopeSelf       DataScope = "self"        // 本人创建的数据
+	DataScopeDept       DataScope = "dept"        // 本部门的数据
+	DataScopeCustomDept DataScope = "custom_dept" // 指定部门的数据
+)
+
+// 角色的数据范围规则
+type DataScopeRule struct {
+	Scope   DataScope // 数据范围
+	DeptIds []string  // 指定部门 | DataScopeCustomDept使用
+}
+
+// 数据范围策略 | 按实体定义一次,通过 WithDataScopePolicy 生效
+//
+// 用户有多个角色时取各角色数据范围的并集;没有匹配的角色时使用Default,Default为空时查询不到任何数据;
+// 用户身份中没有角色时返回错误,避免漏传角色时静默查询不到数据
+type DataScopePolicy struct {
+	UserColumn string                   // 创建人字段 | 默认create_by
+	DeptColumn string                   // 部门字段 | 默认dept_id
+	Roles      map[string]DataScopeRule // 角色对应的数据范围
+	Default    DataScopeRule            // 没有匹配角色时的数据范围
+}
+
+// 用户身份 | 从上下文的currUserId、currDeptId、currRoles读取
+type Identity struct {
+	UserId string   // 用户Id
+	DeptId string   // 部门Id
+	Roles  []string // 角色
+}
+
+// 写入用户身份 | 认证中间件或测试中使用
+func SetIdentity(ctx ModelContext, identity *Identity) {
+	ctx.Set("currUserId", identity.UserId)
+	ctx.Set("currDeptId", identity.DeptId)
+	ctx.Set("currRoles", identity.Roles)
+}
+
+// 读取用户身份 | currRoles支持[]string和逗号分隔的字符串
+func IdentityFromContext(ctx ModelContext) (*Identity, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("Ctx为空,无法读取用户身份,请开发检查")
+	}
+	userId, _ := ctx.Get("currUserId")
+	if userId == nil || userId == "" {
+		return nil, fmt.Errorf("Ctx中[currUserId]不存在,请开发检查")
+	}
+	identity := &Identity{UserId: fmt.Sprintf("%v", userId)}
+	if deptId, ok := ctx.Get("currDeptId"); ok && deptId != nil {
+		identity.DeptId = fmt.Sprintf("%v", deptId)
+	}
+	if roles, ok := ctx.Get("currRoles"); ok {
+		switch roles := roles.(type) {
+		case []string:
+			identity.Roles = roles
+		case string:
+			if roles != "" {
+				identity.Roles = strings.Split(roles, ",")
+			}
+		}
+	}
+	return identity, nil
+}
+
+// 生成数据范围条件 | tableName用于限定字段所属的表,避免关联查询时字段不明确
+func (p *DataScopePolicy) Condition(tableName string, identity *Identity) SearchCondition {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(identity.Roles) == 0 {
+			_ = db.AddError(fmt.Errorf("[%s]用户[%s]没有角色,无法确定数据范围,请检查Ctx中的[currRoles]", tableName, identity.UserId))
+			return db
+		}
+
+		// 匹配角色的数据范围
+		rules := make([]DataScopeRule, 0, len(identity.Roles))
+		for _, role := range identity.Roles {
+			if rule, ok := p.Roles[role]; ok {
+				rules = append(rules, rule)
+			}
+		}
+		if len(rules) == 0 && p.Default.Scope != "" {
+			rules = append(rules, p.Default)
+		}
+
+		// 组合条件 | 取并集
+		exprs := make([]clause.Expression, 0, len(rules))
+		for _, rule := range rules {
+			expr, err := p.expression(tableName, identity, rule)
+			if err != nil {
+				_ = db.AddError(err)
+				return db
+			}
+			if expr == nil {
+				return db
+			}
+			exprs = append(exprs, expr)
+		}
+		if len(exprs) == 0 {
+			return db.Where("1 = 0")
+		}
+		return db.Where(clause.Or(exprs...))
+	}
+}
+
+// 单个数据范围的条件 | 全部数据返回nil
+func (p *DataScopePolicy) expression(tableName string, identity *Identity, rule DataScopeRule) (clause.Expression, error) {
+	userColumn := clause.Column{Table: tableName, Name: p.UserColumn}
+	if p.UserColumn == "" {
+		userColumn.Name = "create_by"
+	}
+	deptColumn := clause.Column{Table: tableName, Name: p.DeptColumn}
+	if p.DeptColumn == "" {
+		deptColumn.Name = "dept_id"
+	}
+
+	switch rule.Scope {
+	case DataScopeAll:
+		return nil, nil
+	case DataScopeSelf:
+		return clause.Eq{Column: userColumn, Value: identity.UserId}, nil
+	case DataScopeDept:
+		if identity.DeptId == "" {
+			return clause.Expr{SQL: "1 = 0"}, nil
+		}
+		return clause.Eq{Column: deptColumn, Value: identity.DeptId}, nil
+	case DataScopeCustomDept:
+		if len(rule.DeptIds) == 0 {
+			return clause.Expr{SQL: "1 = 0"}, nil
+		}
+		values := make([]any, 0, len(rule.DeptIds))
+		for _, deptId := range rule.DeptIds {
+			values = append(values, deptId)
+		}
+		return clause.IN{Column: deptColumn, Values: values}, nil
+	default:
+		return nil, fmt.Errorf("[%s]数据范围[%s]不支持,请开发检查", tableName, rule.Scope)
+	}
+}
+
+// 数据范围策略条件 | 按当前上下文的用户身份生成
+func (b *BaseModel[T]) policyCondition(db *gorm.DB) *gorm.DB {
+	identity, err := IdentityFromContext(b.Ctx)
+	if err != nil {
+		_ = db.AddError(err)
+		return db
+	}
+	return b.DataScopePolicy.Condition(b.TableName, identity)(db)
+}
@@ -0,0 +1,68 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataScopePolicy(t *testing.T) {
+	policy := &DataScopePolicy{
+		Roles: map[string]DataScopeRule{
+			"admin":   {Scope: DataScopeAll},
+			"sales":   {Scope: DataScopeSelf},
+			"manager": {Scope: DataScopeDept},
+			"auditor": {Scope: DataScopeCustomDept, DeptIds: []string{"D2", "D3"}},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		roles []string
+		where string
+	}{
+		{"全部数据", []string{"admin", "sales"}, ""},
+		{"本人数据", []string{"sales"}, "WHERE `test_order`.`create_by` = ? AND"},
+		{"本部门数据", []string{"manager"}, "WHERE `test_order`.`dept_id` = ? AND"},
+		{"多个角色取并集", []string{"sales", "auditor"}, "WHERE (`test_order`.`create_by` = ? OR `test_order`.`dept_id` IN (?,?)) AND"},
+		{"没有匹配的角色", []string{"guest"}, "WHERE 1 = 0 AND"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, sqls := newDryRunOrder(t, WithDataScopePolicy[testOrder](policy))
+			SetIdentity(order.Ctx, &Identity{UserId: "1", DeptId: "D1", Roles: tt.roles})
+			_, _ = order.List()
+			if tt.where == "" {
+				assert.Equal(t, "SELECT * FROM `test_order` WHERE `test_order`.`deleted_at` IS NULL ORDER BY id desc", (*sqls)[0])
+			} else {
+				assert.Contains(t, (*sqls)[0], tt.where)
+			}
+		})
+	}
+
+	// 没有角色时返回错误
+	order, _ := newDryRunOrder(t, WithDataScopePolicy[testOrder](policy))
+	SetIdentity(order.Ctx, &Identity{UserId: "1"})
+	_, err := order.List()
+	assert.ErrorContains(t, err, "没有角色")
+
+	// 不应用权限条件
+	order, sqls := newDryRunOrder(t, WithDataScopePolicy[testOrder](policy), WithoutPermission[testOrder]())
+	SetIdentity(order.Ctx, &Identity{UserId: "1", Roles: []string{"sales"}})
+	_, _ = order.List()
+	assert.NotContains(t, (*sqls)[0], "create_by")
+}
+
+func TestIdentityFromContext(t *testing.T) {
+	order, _ := newDryRunOrder(t)
+	order.Ctx.Set("currDeptId", "D1")
+	order.Ctx.Set("currRoles", "admin,sales")
+	identity, err := IdentityFromContext(order.Ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, &Identity{UserId: "1", DeptId: "D1", Roles: []string{"admin", "sales"}}, identity)
+
+	// 缺少用户Id
+	order.Ctx.Set("currUserId", "")
+	_, err = IdentityFromContext(order.Ctx)
+	assert.NotNil(t, err)
+}
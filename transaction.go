@@ -0,0 +1,175 @@
+package base
+
+import (
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// 事务传播方式
+type Propagation int
+
+const (
+	PropagationRequired    Propagation = iota // 已有事务则加入,否则开启新事务 | 默认
+	PropagationRequiresNew                    // 总是开启新事务,外层事务挂起,内外事务独立提交
+	PropagationNested                         // 已有事务则创建保存点,失败只回滚到保存点;否则开启新事务
+)
+
+// 事务作用域 | 存放在Ctx中,嵌套调用时共享
+type txScope struct {
+	db           *gorm.DB // 事务Db
+	rollbackOnly bool     // 加入的内层事务失败,外层事务只能回滚
+	onCommit     []func() // 提交后回调
+	onRollback   []func() // 回滚后回调
+}
+
+// 获取事务Db
+func (m *BaseModel[T]) Tx() *gorm.DB {
+	db, exist := m.Ctx.Get("txDb")
+	if exist && db != nil {
+		return db.(*gorm.DB)
+	}
+	return m.Db
+}
+
+// 获取查询Db | 开启事务时使用事务Db,保证能读到事务中未提交的数据;WithReadOutsideTx可关闭
+func (m *BaseModel[T]) readDb() *gorm.DB {
+	if m.ReadOutsideTx {
+		return m.Db
+	}
+	return m.Tx()
+}
+
+// 开启事务 | 已有事务时加入外层事务(PropagationRequired)
+func (m *BaseModel[T]) Transaction(fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
+	return m.TransactionWithPropagation(PropagationRequired, fc, opts...)
+}
+
+// 按传播方式开启事务
+//
+// PropagationRequired: 加入外层事务,内层失败时外层事务会被标记为只能回滚
+// PropagationRequiresNew: 使用新连接开启独立事务,结束后恢复外层事务
+// PropagationNested: 在外层事务中创建保存点,内层失败回滚到保存点,不影响外层事务
+func (m *BaseModel[T]) TransactionWithPropagation(propagation Propagation, fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
+	outer := m.currTxScope()
+	if outer != nil {
+		switch propagation {
+		case PropagationRequired:
+			// 加入外层事务
+			if err := fc(outer.db); err != nil {
+				outer.rollbackOnly = true
+				return err
+			}
+			return nil
+		case PropagationNested:
+			// 创建保存点 | gorm在事务Db上开启事务时自动使用SAVEPOINT
+			scope := &txScope{}
+			err := outer.db.Transaction(func(tx *gorm.DB) error {
+				scope.db = tx
+				return m.runInTxScope(scope, fc)
+			})
+
+			// 保存点成功,回调交给外层事务;保存点回滚,回滚回调在外层事务提交或回滚后执行
+			if err != nil {
+				outer.onCommit = append(outer.onCommit, scope.onRollback...)
+				outer.onRollback = append(outer.onRollback, scope.onRollback...)
+				return err
+			}
+			outer.onCommit = append(outer.onCommit, scope.onCommit...)
+			outer.onRollback = append(outer.onRollback, scope.onRollback...)
+			return nil
+		}
+	}
+
+	// 开启新事务
+	scope := &txScope{}
+	committed := false
+	defer func() {
+		// 提交或回滚后执行回调 | 异常退出也执行回滚回调
+		if committed {
+			runCallbacks(scope.onCommit)
+		} else {
+			runCallbacks(scope.onRollback)
+		}
+	}()
+	err := m.Db.Transaction(func(tx *gorm.DB) error {
+		scope.db = tx
+		return m.runInTxScope(scope, fc)
+	}, opts...)
+	committed = err == nil
+	return err
+}
+
+// 注册事务提交后回调
+//
+// 事务中注册时,在最外层事务提交后执行;没有开启事务时立即执行
+func (m *BaseModel[T]) OnCommit(fn func()) {
+	scope := m.currTxScope()
+	if scope == nil {
+		fn()
+		return
+	}
+	scope.onCommit = append(scope.onCommit, fn)
+}
+
+// 注册事务回滚后回调
+//
+// 事务中注册时,在事务回滚后执行;保存点回滚时,在外层事务提交或回滚后执行;
+// 没有开启事务时不存在回滚,直接忽略
+func (m *BaseModel[T]) OnRollback(fn func()) {
+	scope := m.currTxScope()
+	if scope == nil {
+		return
+	}
+	scope.onRollback = append(scope.onRollback, fn)
+}
+
+// 按注册顺序执行回调
+func runCallbacks(callbacks []func()) {
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
+// 在事务作用域中执行 | 结束后恢复外层作用域
+func (m *BaseModel[T]) runInTxScope(scope *txScope, fc func(tx *gorm.DB) error) error {
+	outer := m.currTxScope()
+	m.setTxScope(scope)
+	defer m.setTxScope(outer)
+
+	// 执行事务逻辑代码
+	if err := fc(scope.db); err != nil {
+		return err
+	}
+	if scope.rollbackOnly {
+		return fmt.Errorf("事务中有操作执行失败,事务已回滚,请开发检查")
+	}
+	return nil
+}
+
+// 当前事务作用域 | 没有事务返回nil
+func (m *BaseModel[T]) currTxScope() *txScope {
+	scope, exist := m.Ctx.Get("txScope")
+	if !exist || scope == nil {
+		return nil
+	}
+	return scope.(*txScope)
+}
+
+// 设置事务作用域 | 同步预埋事务Db
+func (m *BaseModel[T]) setTxScope(scope *txScope) {
+	if scope == nil {
+		m.Ctx.Set("txScope", nil)
+		m.Ctx.Set("txDb", nil)
+		return
+	}
+	m.Ctx.Set("txScope", scope)
+	m.Ctx.Set("txDb", scope.db)
+}
+
+// 检查是否已经开启事务
+func (m *BaseModel[T]) IsInTransaction() bool {
+	db, exist := m.Ctx.Get("txDb")
+	return exist && db != nil
+}
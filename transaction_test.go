@@ -0,0 +1,146 @@
+package base
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// 记录保存点SQL
+func recordSavePoints(db *gorm.DB) *[]string {
+	sqls := make([]string, 0)
+	_ = db.Callback().Raw().After("gorm:raw").Register("test:savepoint", func(tx *gorm.DB) {
+		if sql := tx.Statement.SQL.String(); strings.Contains(sql, "SAVEPOINT") {
+			sqls = append(sqls, strings.Fields(sql)[0])
+		}
+	})
+	return &sqls
+}
+
+func TestTransactionRequired(t *testing.T) {
+	order, _ := newDryRunOrder(t)
+	pool := order.Db.Statement.ConnPool.(*dryRunPool)
+
+	// 内层失败时外层事务只能回滚
+	err := order.Transaction(func(tx *gorm.DB) error {
+		innerErr := order.Transaction(func(inner *gorm.DB) error {
+			assert.Same(t, tx, inner)
+			return errors.New("inner failed")
+		})
+		assert.NotNil(t, innerErr)
+		return nil
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, pool.begins)
+	assert.Equal(t, 0, pool.commits)
+	assert.Equal(t, 1, pool.rollbacks)
+	assert.False(t, order.IsInTransaction())
+}
+
+func TestTransactionNested(t *testing.T) {
+	order, _ := newDryRunOrder(t)
+	pool := order.Db.Statement.ConnPool.(*dryRunPool)
+	savePoints := recordSavePoints(order.Db)
+
+	// 内层失败只回滚到保存点,外层事务正常提交
+	err := order.Transaction(func(tx *gorm.DB) error {
+		innerErr := order.TransactionWithPropagation(PropagationNested, func(inner *gorm.DB) error {
+			return errors.New("inner failed")
+		})
+		assert.NotNil(t, innerErr)
+		return order.TransactionWithPropagation(PropagationNested, func(inner *gorm.DB) error {
+			return nil
+		})
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"SAVEPOINT", "ROLLBACK", "SAVEPOINT"}, *savePoints)
+	assert.Equal(t, 1, pool.begins)
+	assert.Equal(t, 1, pool.commits)
+	assert.Equal(t, 0, pool.rollbacks)
+}
+
+func TestTransactionRequiresNew(t *testing.T) {
+	order, _ := newDryRunOrder(t)
+	pool := order.Db.Statement.ConnPool.(*dryRunPool)
+
+	// 开启独立事务,内层回滚不影响外层,结束后恢复外层事务
+	err := order.Transaction(func(tx *gorm.DB) error {
+		innerErr := order.TransactionWithPropagation(PropagationRequiresNew, func(inner *gorm.DB) error {
+			assert.NotSame(t, tx.Statement.ConnPool, inner.Statement.ConnPool)
+			assert.Same(t, inner, order.Tx())
+			return errors.New("inner failed")
+		})
+		assert.NotNil(t, innerErr)
+		assert.Same(t, tx, order.Tx())
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, pool.begins)
+	assert.Equal(t, 1, pool.commits)
+	assert.Equal(t, 1, pool.rollbacks)
+}
+
+func TestTransactionCallbacks(t *testing.T) {
+	order, _ := newDryRunOrder(t)
+	calls := make([]string, 0)
+	record := func(name string) func() {
+		return func() { calls = append(calls, name) }
+	}
+
+	// 提交后执行提交回调
+	err := order.Transaction(func(tx *gorm.DB) error {
+		order.OnCommit(record("commit"))
+		order.OnRollback(record("rollback"))
+		assert.Empty(t, calls)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"commit"}, calls)
+
+	// 回滚后执行回滚回调
+	calls = calls[:0]
+	err = order.Transaction(func(tx *gorm.DB) error {
+		order.OnCommit(record("commit"))
+		order.OnRollback(record("rollback"))
+		return errors.New("failed")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"rollback"}, calls)
+
+	// 保存点回滚时,回滚回调在外层事务结束后执行
+	calls = calls[:0]
+	err = order.Transaction(func(tx *gorm.DB) error {
+		_ = order.TransactionWithPropagation(PropagationNested, func(inner *gorm.DB) error {
+			order.OnCommit(record("nested commit"))
+			order.OnRollback(record("nested rollback"))
+			return errors.New("nested failed")
+		})
+		assert.Empty(t, calls)
+		order.OnCommit(record("commit"))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"nested rollback", "commit"}, calls)
+
+	// 保存点成功,外层回滚时执行保存点的回滚回调
+	calls = calls[:0]
+	err = order.Transaction(func(tx *gorm.DB) error {
+		_ = order.TransactionWithPropagation(PropagationNested, func(inner *gorm.DB) error {
+			order.OnCommit(record("nested commit"))
+			order.OnRollback(record("nested rollback"))
+			return nil
+		})
+		return errors.New("failed")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"nested rollback"}, calls)
+
+	// 没有事务时立即执行提交回调,忽略回滚回调
+	calls = calls[:0]
+	order.OnCommit(record("commit"))
+	order.OnRollback(record("rollback"))
+	assert.Equal(t, []string{"commit"}, calls)
+}
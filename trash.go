@@ -0,0 +1,249 @@
+package base
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 删除数据 | list需要预加载一对多子表;删除校验 -> 处理子表数据 -> 软删除 -> 每条记录一条操作日志,返回影响的条数
+func (b *BaseModel[T]) deleteEntities(tx *gorm.DB, list []*T, operatorTypeName string) (int64, error) {
+	// 1. 删除校验
+	ids := make([]uint64, 0, len(list))
+	for _, item := range list {
+		b.bindEntity(item)
+		if validator, ok := any(item).(interface{ ValidateDelete() error }); ok {
+			if err := validator.ValidateDelete(); err != nil {
+				return 0, err
+			}
+		}
+		ids = append(ids, entityId(item))
+	}
+
+	// 2. 处理子表数据 | 按onDelete标记级联删除、禁止删除或解除关联,级联删除与主表使用同一删除时间
+	deletedAt := time.Now()
+	if err := b.deleteAssociations(tx, list, deletedAt); err != nil {
+		return 0, err
+	}
+
+	// 3. 执行删除操作
+	affected, err := b.softDelete(tx, ids, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	// 4. 记录日志
+	for _, item := range list {
+		if err := b.RecordLog(LogTypeDelete, operatorTypeName, item, nil); err != nil {
+			return 0, err
+		}
+	}
+	return affected, nil
+}
+
+// 软删除数据 | 记录删除时间,实体声明了deleted_by字段时记录删除人,返回影响的条数
+func (b *BaseModel[T]) softDelete(tx *gorm.DB, ids []uint64, deletedAt time.Time) (int64, error) {
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return 0, err
+	}
+	updates := map[string]any{"deleted_at": deletedAt}
+	if modelSchema.LookUpField("deleted_by") != nil {
+		updates["deleted_by"] = b.OperatorId
+	}
+	res := tx.Model(new(T)).Where("id in ?", ids).UpdateColumns(updates)
+	return res.RowsAffected, res.Error
+}
+
+// 恢复已删除的数据 | 应用默认条件和权限条件,恢复前校验WithBusinessCodes配置的业务编码没有被未删除的数据占用
+//
+// 同时恢复删除主表数据时级联删除的子表数据
+func (b *BaseModel[T]) Restore(ids ...uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return b.Transaction(func(tx *gorm.DB) error {
+		// 1. 查询已删除的数据
+		list := make([]*T, 0)
+		err := tx.Unscoped().
+			Where("id in ?", ids).
+			Where(fmt.Sprintf("`%s`.`deleted_at` is not null", b.TableName)).
+			Scopes(b.dataScope). // 数据范围
+			Find(&list).Error
+		if err != nil {
+			return err
+		}
+		if missing := missingIds(ids, list); len(missing) > 0 {
+			return fmt.Errorf("[%s]数据%v不存在、未删除或无权限,请检查", b.TableName, missing)
+		}
+
+		// 2. 校验业务编码唯一
+		if err := b.checkRestoreUnique(tx, list); err != nil {
+			return err
+		}
+
+		// 3. 恢复数据 | 实体声明了deleted_by字段时清空删除人
+		modelSchema, err := b.parseSchema()
+		if err != nil {
+			return err
+		}
+		updates := map[string]any{
+			"deleted_at":     nil,
+			"update_by":      b.OperatorId,
+			"update_by_name": b.OperatorName,
+			"updated_at":     b.CurrTime(),
+		}
+		if modelSchema.LookUpField("deleted_by") != nil {
+			updates["deleted_by"] = ""
+		}
+		err = tx.Unscoped().Model(new(T)).Where("id in ?", ids).UpdateColumns(updates).Error
+		if err != nil {
+			return err
+		}
+
+		// 4. 恢复级联删除的子表数据
+		if err := b.restoreAssociations(tx, list); err != nil {
+			return err
+		}
+
+		// 5. 记录日志
+		for _, item := range list {
+			if err := b.RecordLog(LogTypeRestore, "恢复", nil, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 校验恢复的数据业务编码唯一 | 不能与未删除的数据重复,恢复的数据之间也不能重复
+func (b *BaseModel[T]) checkRestoreUnique(tx *gorm.DB, list []*T) error {
+	if len(b.BusinessCodes) == 0 {
+		return nil
+	}
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return err
+	}
+	for _, fieldName := range b.BusinessCodes {
+		if err := validateSafeColumnName(fieldName); err != nil {
+			return err
+		}
+		field := modelSchema.LookUpField(fieldName)
+		if field == nil || field.DBName == "" {
+			return fmt.Errorf("[%s]业务编码字段[%s]不存在,请开发检查", b.TableName, fieldName)
+		}
+
+		// 恢复的数据之间重复
+		values := make([]string, 0, len(list))
+		seen := make(map[string]struct{}, len(list))
+		for _, item := range list {
+			value, _ := field.ValueOf(tx.Statement.Context, reflect.ValueOf(item).Elem())
+			code := fmt.Sprintf("%v", value)
+			if _, ok := seen[code]; ok {
+				return fmt.Errorf("[%s]恢复的数据中[%s]重复[%s],请检查", b.TableName, fieldName, code)
+			}
+			seen[code] = struct{}{}
+			values = append(values, code)
+		}
+
+		// 与未删除的数据重复
+		exists := make([]string, 0)
+		err := tx.Model(new(T)).Where(fmt.Sprintf("%s in ?", field.DBName), values).Pluck(field.DBName, &exists).Error
+		if err != nil {
+			return err
+		}
+		if len(exists) > 0 {
+			return fmt.Errorf("[%s][%s]已存在[%s],不能恢复", b.TableName, fieldName, strings.Join(exists, ","))
+		}
+	}
+	return nil
+}
+
+// 查询已删除的数据 | 应用默认条件和权限条件,按删除时间倒序
+func (b *BaseModel[T]) ListTrashed(conds ...SearchCondition) ([]*T, error) {
+	list := make([]*T, 0)
+	err := b.readDb().Unscoped().
+		Scopes(b.dataScope). // 数据范围
+		Scopes(conds...).    // 搜索条件
+		Where(fmt.Sprintf("`%s`.`deleted_at` is not null", b.TableName)).
+		Order(fmt.Sprintf("`%s`.`deleted_at` desc", b.TableName)).
+		Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// 彻底删除 | 物理删除删除时间早于olderThan之前的数据,返回删除的条数
+//
+// 用于定时清理,全表范围,不应用默认条件和权限条件;一对多子表中超过保留期的已删除数据一并清理
+func (b *BaseModel[T]) Purge(olderThan time.Duration) (int64, error) {
+	var affected int64
+	cutoff := time.Now().Add(-olderThan)
+	err := b.Transaction(func(tx *gorm.DB) error {
+		// 1. 清理子表数据
+		if err := b.purgeAssociations(tx, cutoff); err != nil {
+			return err
+		}
+
+		// 2. 查询超过保留期的数据Id
+		ids := make([]uint64, 0)
+		err := tx.Unscoped().Model(new(T)).
+			Where(fmt.Sprintf("`%s`.`deleted_at` < ?", b.TableName), cutoff).
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		// 3. 物理删除
+		res := tx.Unscoped().Where("id in ?", ids).Delete(new(T))
+		if res.Error != nil {
+			return res.Error
+		}
+		affected = res.RowsAffected
+
+		// 4. 记录日志
+		for _, id := range ids {
+			if err := b.RecordLog(LogTypePurge, "彻底删除", &bulkChange{Id: id}, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
+// 未查询到的Id
+func missingIds[T any](ids []uint64, list []*T) []uint64 {
+	found := make(map[uint64]struct{}, len(list))
+	for _, item := range list {
+		found[entityId(item)] = struct{}{}
+	}
+	missing := make([]uint64, 0)
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// Id转换为只有Id的数据 | 用于missingIds对比
+func idsToEntities[T any](ids []uint64) []*T {
+	list := make([]*T, 0, len(ids))
+	for _, id := range ids {
+		item := new(T)
+		if field := reflect.ValueOf(item).Elem().FieldByName("Id"); field.IsValid() && field.CanSet() {
+			field.SetUint(id)
+		}
+		list = append(list, item)
+	}
+	return list
+}
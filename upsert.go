@@ -0,0 +1,177 @@
+package base
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 按业务编码新增或更新 | 业务编码已存在时更新,否则新增,返回是否为新增
+//
+// 先按业务编码查出已存在数据的Id,再使用 INSERT ... ON DUPLICATE KEY UPDATE 按主键更新;
+// 更新时不修改创建人、创建时间;业务编码对应的数据已软删除时返回错误,需要先恢复;子表数据不处理;
+// 与List一样应用默认条件和权限条件,业务编码已存在但不在数据范围内时返回错误
+func (b *BaseModel[T]) UpsertByBusinessCode(fieldName string, data *T) (bool, error) {
+	inserted, err := b.UpsertByBusinessCodes(fieldName, []*T{data})
+	if err != nil {
+		return false, err
+	}
+	return inserted[0], nil
+}
+
+// 按业务编码批量新增或更新 | 返回每条数据是否为新增,与入参顺序一致
+func (b *BaseModel[T]) UpsertByBusinessCodes(fieldName string, items []*T) ([]bool, error) {
+	if err := validateSafeColumnName(fieldName); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return []bool{}, nil
+	}
+
+	// 业务编码字段
+	modelSchema, err := b.parseSchema()
+	if err != nil {
+		return nil, err
+	}
+	codeField := modelSchema.LookUpField(fieldName)
+	if codeField == nil || codeField.DBName == "" {
+		return nil, fmt.Errorf("[%s]业务编码字段[%s]不存在,请开发检查", b.TableName, fieldName)
+	}
+
+	// 读取业务编码 | 同一批次中不允许重复
+	codes := make([]string, 0, len(items))
+	for _, item := range items {
+		value, _ := codeField.ValueOf(b.Db.Statement.Context, reflect.ValueOf(item).Elem())
+		code := fmt.Sprintf("%v", value)
+		if slices.Contains(codes, code) {
+			return nil, fmt.Errorf("[%s]业务编码[%s]重复,请检查数据", b.TableName, code)
+		}
+		codes = append(codes, code)
+	}
+
+	// 更新的字段 | 排除主键、创建信息和删除标记,更新人信息单独赋值
+	columns := make([]string, 0, len(modelSchema.DBNames))
+	for _, field := range modelSchema.Fields {
+		if field.DBName == "" || !field.Creatable || field.PrimaryKey || field.DBName == codeField.DBName || field.DBName == "deleted_at" {
+			continue
+		}
+		if slices.Contains(OmitCreateFileds, field.DBName) || slices.Contains(OmitUpdateFileds, field.DBName) {
+			continue
+		}
+		if field.Tag.Get("lock") == "version" {
+			continue
+		}
+		columns = append(columns, field.DBName)
+	}
+	assignments := clause.AssignmentColumns(columns)
+	assignments = append(assignments, clause.Assignments(map[string]any{
+		"update_by":      b.OperatorId,
+		"update_by_name": b.OperatorName,
+		"updated_at":     b.CurrTime(),
+	})...)
+	if versionField, err := b.versionField(); err == nil && versionField != nil {
+		assignments = append(assignments, clause.Assignment{
+			Column: clause.Column{Name: versionField.DBName},
+			Value:  gorm.Expr(fmt.Sprintf("`%s` + 1", versionField.DBName)),
+		})
+	}
+
+	inserted := make([]bool, len(items))
+	err = b.Transaction(func(tx *gorm.DB) error {
+		// 1. 查询已存在的数据 | 应用默认条件和权限条件,包含已软删除的数据,已软删除的不自动恢复
+		olds := make([]*T, 0)
+		err := tx.Unscoped().
+			Scopes(b.dataScope). // 数据范围
+			Where(fmt.Sprintf("%s in ?", fieldName), codes).
+			Find(&olds).Error
+		if err != nil {
+			return err
+		}
+		oldMap := make(map[string]*T, len(olds))
+		for _, old := range olds {
+			value, _ := codeField.ValueOf(tx.Statement.Context, reflect.ValueOf(old).Elem())
+			code := fmt.Sprintf("%v", value)
+			if model := modelOf(old); model != nil && model.DeletedAt.Valid {
+				return fmt.Errorf("[%s]业务编码[%s]对应的数据已删除,请先恢复", b.TableName, code)
+			}
+			oldMap[code] = old
+		}
+
+		// 2. 数据范围外已存在的业务编码不允许更新
+		if len(oldMap) < len(codes) {
+			exists := make([]string, 0)
+			err := tx.Unscoped().Model(new(T)).Where(fmt.Sprintf("%s in ?", fieldName), codes).Pluck(codeField.DBName, &exists).Error
+			if err != nil {
+				return err
+			}
+			denied := make([]string, 0)
+			for _, code := range exists {
+				if _, ok := oldMap[code]; !ok {
+					denied = append(denied, code)
+				}
+			}
+			if len(denied) > 0 {
+				return fmt.Errorf("[%s]业务编码%v已存在,无权限更新", b.TableName, denied)
+			}
+		}
+
+		// 3. 已存在的数据使用原Id,并与旧数据对比校验字段编辑权限
+		for i, item := range items {
+			old, exist := oldMap[codes[i]]
+			inserted[i] = !exist
+			if exist {
+				_ = modelSchema.PrioritizedPrimaryField.Set(tx.Statement.Context, reflect.ValueOf(item).Elem(), entityId(old))
+				if err := b.checkEditable(old, item); err != nil {
+					return err
+				}
+			}
+		}
+
+		// 4. 新增或更新
+		err = tx.Omit(append(slices.Clone(OmitUpdateFileds), clause.Associations)...).
+			Clauses(clause.OnConflict{DoUpdates: assignments}).
+			Create(items).Error
+		if err != nil {
+			return err
+		}
+
+		// 5. 回填新增数据的Id | 批量插入中有更新的数据时,自增Id不连续
+		if slices.Contains(inserted, true) && len(items) > 1 {
+			idMap := make(map[string]uint64)
+			rows := make([]*T, 0)
+			err = tx.Unscoped().Where(fmt.Sprintf("%s in ?", fieldName), codes).Find(&rows).Error
+			if err != nil {
+				return err
+			}
+			for _, row := range rows {
+				value, _ := codeField.ValueOf(tx.Statement.Context, reflect.ValueOf(row).Elem())
+				idMap[fmt.Sprintf("%v", value)] = entityId(row)
+			}
+			for i, item := range items {
+				if inserted[i] {
+					_ = modelSchema.PrioritizedPrimaryField.Set(tx.Statement.Context, reflect.ValueOf(item).Elem(), idMap[codes[i]])
+				}
+			}
+		}
+
+		// 6. 记录日志
+		for i, item := range items {
+			if inserted[i] {
+				err = b.RecordLog(LogTypeCreate, "新增", new(T), item)
+			} else {
+				err = b.RecordLog(LogTypeUpdate, "更新", oldMap[codes[i]], item)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}